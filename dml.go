@@ -4,15 +4,18 @@
 package gomapper
 
 import (
+	"context"
 	"database/sql"
 	"errors"
-	"fmt"
 	"time"
 )
 
 func (gm *GoMapper) Close() error {
 	db, ok := gm.DB.(*sql.DB)
 	if ok && db != nil {
+		if gm.stmts != nil {
+			gm.stmts.close()
+		}
 		return db.Close()
 	} else {
 		return errors.New("Invalid *sql.DB instance")
@@ -20,13 +23,24 @@ func (gm *GoMapper) Close() error {
 }
 
 func (gm *GoMapper) Begin() (*GoMapperTx, error) {
+	return gm.BeginTx(context.Background(), nil)
+}
+
+// the transaction is rolled back if ctx is done before Commit/Rollback
+func (gm *GoMapper) BeginTx(ctx context.Context, opts *sql.TxOptions) (*GoMapperTx, error) {
 	db, ok := gm.DB.(*sql.DB)
 	if ok && db != nil {
 		var err error
 		gmtx := new(GoMapperTx)
 		gmtx.sqlMap = gm.sqlMap
 		gmtx.logFunc = gm.logFunc
-		gmtx.DB, err = db.Begin()
+		gmtx.stmts = gm.stmts
+		gmtx.naming = gm.naming
+		gmtx.plans = gm.plans
+		gmtx.policy = gm.policy
+		gmtx.nullAsZero = gm.nullAsZero
+		gmtx.handlers = gm.handlers
+		gmtx.DB, err = db.BeginTx(ctx, opts)
 		return gmtx, err
 	} else {
 		return nil, errors.New("Invalid *sql.DB instance")
@@ -50,46 +64,50 @@ func (gmtx *GoMapperTx) Rollback() error {
 }
 
 // underlying implementation of Insert/Update/Delete
-func (m *Mapper) dml(id string, args ...interface{}) (sql.Result, error) {
+func (m *Mapper) dml(ctx context.Context, id string, args ...interface{}) (sql.Result, error) {
 	element, err := m.sqlMap.Get(id)
 	if err != nil {
 		return nil, err
 	}
 
-	var start int64
-	if m.logFunc != nil {
-		start = time.Now().UnixNano()
-	}
-
-	sqlArgs, err := ParseQueryArgs(element.Vars, args...)
+	query, sqlArgs, err := element.bind(args, m.namingStrategy(), m.handlers)
 	if err != nil {
 		return nil, err
 	}
 
-	if m.logFunc != nil && start != 0 {
-		end := time.Now().UnixNano()
-		elaspedMs := float64(end-start) / float64(1000000)
-		sqlFormat := sqlVarsRegexp.ReplaceAllString(element.Sql, "'%v'")
-		sqlCommand := fmt.Sprintf(sqlFormat, sqlArgs...)
-		m.logFunc("\033[36;1m[%.2fms]\033[0m %s\n", elaspedMs, sqlCommand)
-	}
-
-	result, err := m.DB.Exec(element.Sql, sqlArgs...)
+	start := time.Now()
+	result, err := m.execContext(ctx, element, query, sqlArgs)
+	m.log(ctx, start, query, sqlArgs)
 
 	return result, err
 }
 
 // args can be Struct
 func (m *Mapper) Insert(id string, args ...interface{}) (sql.Result, error) {
-	return m.dml(id, args...)
+	return m.dml(context.Background(), id, args...)
 }
 
 // args can be Struct
 func (m *Mapper) Update(id string, args ...interface{}) (sql.Result, error) {
-	return m.dml(id, args...)
+	return m.dml(context.Background(), id, args...)
 }
 
 // args can be Struct
 func (m *Mapper) Delete(id string, args ...interface{}) (sql.Result, error) {
-	return m.dml(id, args...)
+	return m.dml(context.Background(), id, args...)
+}
+
+// same as Insert, the statement is canceled when ctx is done
+func (m *Mapper) InsertContext(ctx context.Context, id string, args ...interface{}) (sql.Result, error) {
+	return m.dml(ctx, id, args...)
+}
+
+// same as Update, the statement is canceled when ctx is done
+func (m *Mapper) UpdateContext(ctx context.Context, id string, args ...interface{}) (sql.Result, error) {
+	return m.dml(ctx, id, args...)
+}
+
+// same as Delete, the statement is canceled when ctx is done
+func (m *Mapper) DeleteContext(ctx context.Context, id string, args ...interface{}) (sql.Result, error) {
+	return m.dml(ctx, id, args...)
 }
@@ -0,0 +1,588 @@
+package gomapper
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var lineBreakRegexp = regexp.MustCompile(`[ \t]*[\r\n][\s]*`)
+var sqlVarRegexp = regexp.MustCompile(`#\{[^}]*\}`)
+
+// Dynamic sql elements, nested in select/insert/update/delete:
+//
+//	<if test="expr">...</if>
+//	<where>...</where>          WHERE + content, leading AND/OR removed, nothing if content is empty
+//	<set>...</set>              SET + content, trailing "," removed, nothing if content is empty
+//	<trim prefix="" suffix="" prefixOverrides="AND |OR " suffixOverrides=",">...</trim>
+//	<choose><when test="expr">...</when>...<otherwise>...</otherwise></choose>
+//	<foreach collection="Ids" item="id" index="i" open="(" separator="," close=")">#{id}</foreach>
+//
+// Statements are rendered against the passed in struct or map at call time, see expr.go for expressions.
+type sqlNode interface {
+	apply(ctx *dynamicContext) error
+}
+
+type dynamicContext struct {
+	arg    reflect.Value // the only struct or map argument, invalid if not passed
+	naming NamingStrategy
+	buf    *strings.Builder
+
+	// values bound by <foreach>, item and index names in scope are renamed
+	// to unique names of bindings, so that #{item} refers to the right element
+	bindings map[string]interface{}
+	scope    map[string]string
+	seq      int
+}
+
+// plain text containing #{Var}
+type textNode string
+
+// children in order
+type mixedNode []sqlNode
+
+type ifNode struct {
+	test     expr
+	contents sqlNode
+}
+
+type trimNode struct {
+	prefix, suffix                   string
+	prefixOverrides, suffixOverrides []string
+	contents                         sqlNode
+}
+
+type foreachNode struct {
+	collection             string
+	item, index            string
+	open, separator, close string
+	contents               sqlNode
+}
+
+type chooseNode struct {
+	whens     []*ifNode
+	otherwise sqlNode // nil if no <otherwise>
+}
+
+func (n textNode) apply(ctx *dynamicContext) error {
+	if len(ctx.scope) == 0 {
+		ctx.buf.WriteString(string(n))
+		return nil
+	}
+	// rename variables bound by <foreach>
+	ctx.buf.WriteString(sqlVarRegexp.ReplaceAllStringFunc(string(n), func(v string) string {
+		name := strings.TrimSpace(v[2 : len(v)-1])
+		first, rest := name, ""
+		if i := strings.IndexAny(name, ".,"); i >= 0 {
+			first, rest = name[:i], name[i:]
+		}
+		if unique, ok := ctx.scope[first]; ok {
+			return "#{" + unique + rest + "}"
+		}
+		return v
+	}))
+	return nil
+}
+
+func (n mixedNode) apply(ctx *dynamicContext) error {
+	for _, child := range n {
+		if err := child.apply(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (n *ifNode) apply(ctx *dynamicContext) error {
+	ok, err := evalTest(n.test, ctx)
+	if err != nil || !ok {
+		return err
+	}
+	return n.contents.apply(ctx)
+}
+
+func (n *trimNode) apply(ctx *dynamicContext) error {
+	// render contents into a new buffer
+	outer := ctx.buf
+	ctx.buf = new(strings.Builder)
+	err := n.contents.apply(ctx)
+	body := strings.TrimSpace(ctx.buf.String())
+	ctx.buf = outer
+	if err != nil {
+		return err
+	}
+
+	upper := strings.ToUpper(body)
+	for _, o := range n.prefixOverrides {
+		if strings.HasPrefix(upper, strings.ToUpper(o)) {
+			body = strings.TrimSpace(body[len(o):])
+			break
+		}
+	}
+	upper = strings.ToUpper(body)
+	for _, o := range n.suffixOverrides {
+		if strings.HasSuffix(upper, strings.ToUpper(o)) {
+			body = strings.TrimSpace(body[:len(body)-len(o)])
+			break
+		}
+	}
+	if body == "" {
+		return nil
+	}
+
+	ctx.buf.WriteString(" ")
+	if n.prefix != "" {
+		ctx.buf.WriteString(n.prefix + " ")
+	}
+	ctx.buf.WriteString(body)
+	if n.suffix != "" {
+		ctx.buf.WriteString(" " + n.suffix)
+	}
+	ctx.buf.WriteString(" ")
+	return nil
+}
+
+func (n *foreachNode) apply(ctx *dynamicContext) error {
+	collection, err := ctx.lookup(n.collection)
+	if err != nil {
+		return err
+	}
+	value := reflect.ValueOf(collection)
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+
+	// keys of map are sorted to render the same sql every time
+	var keys []reflect.Value
+	switch value.Kind() {
+	case reflect.Invalid:
+		return nil
+	case reflect.Slice, reflect.Array:
+	case reflect.Map:
+		keys = value.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+	default:
+		return errors.New(fmt.Sprintf("collection '%s' of <foreach> is %s, not slice/array/map", n.collection, value.Type()))
+	}
+	if value.Len() == 0 {
+		return nil
+	}
+
+	if ctx.bindings == nil {
+		ctx.bindings = make(map[string]interface{})
+	}
+	outerScope := ctx.scope
+	ctx.scope = make(map[string]string, len(outerScope)+2)
+	for k, v := range outerScope {
+		ctx.scope[k] = v
+	}
+	defer func() { ctx.scope = outerScope }()
+
+	bind := func(name string, v interface{}) {
+		if name == "" {
+			return
+		}
+		unique := fmt.Sprintf("__foreach_%s_%d", name, ctx.seq)
+		ctx.seq++
+		ctx.bindings[unique] = v
+		ctx.scope[name] = unique
+	}
+
+	ctx.buf.WriteString(n.open)
+	for i := 0; i < value.Len(); i++ {
+		if i > 0 {
+			ctx.buf.WriteString(n.separator)
+		}
+		if keys != nil {
+			bind(n.index, keys[i].Interface())
+			bind(n.item, value.MapIndex(keys[i]).Interface())
+		} else {
+			bind(n.index, i)
+			bind(n.item, value.Index(i).Interface())
+		}
+		if err := n.contents.apply(ctx); err != nil {
+			return err
+		}
+	}
+	ctx.buf.WriteString(n.close)
+	return nil
+}
+
+func (n *chooseNode) apply(ctx *dynamicContext) error {
+	for _, when := range n.whens {
+		ok, err := evalTest(when.test, ctx)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return when.contents.apply(ctx)
+		}
+	}
+	if n.otherwise != nil {
+		return n.otherwise.apply(ctx)
+	}
+	return nil
+}
+
+// find value of identifier used in expressions, missing keys of map are nil
+func (ctx *dynamicContext) lookup(path string) (interface{}, error) {
+	v, err := ctx.resolve(path, false)
+	var missing *missingKeyError
+	if errors.As(err, &missing) {
+		return nil, nil
+	}
+	return v, err
+}
+
+// find value of identifier, fields tagged `db:",json"` are marshaled if used as argument of query
+func (ctx *dynamicContext) resolve(path string, arg bool) (interface{}, error) {
+	find := func(value reflect.Value, path string) (interface{}, error) {
+		if arg {
+			return lookupArg(value, path, ctx.naming)
+		}
+		v, err := lookupValue(value, path, ctx.naming)
+		if err != nil || !v.IsValid() {
+			return nil, err
+		}
+		return v.Interface(), nil
+	}
+
+	// values bound by <foreach>
+	first, rest := path, ""
+	if i := strings.IndexByte(path, '.'); i >= 0 {
+		first, rest = path[:i], path[i+1:]
+	}
+	if unique, ok := ctx.scope[first]; ok {
+		first = unique
+	}
+	if bound, ok := ctx.bindings[first]; ok {
+		if rest == "" {
+			return bound, nil
+		}
+		return find(reflect.ValueOf(bound), rest)
+	}
+
+	if !ctx.arg.IsValid() {
+		return nil, errors.New(fmt.Sprintf("can not resolve '%s', dynamic sql needs a struct or map argument", path))
+	}
+	return find(ctx.arg, path)
+}
+
+// the single struct or map argument which variables are resolved from, invalid if not passed
+func paramObject(args []interface{}) reflect.Value {
+	if len(args) == 1 {
+		v := reflect.Indirect(reflect.ValueOf(args[0]))
+		if v.Kind() == reflect.Struct || v.Kind() == reflect.Map {
+			return v
+		}
+	}
+	return reflect.Value{}
+}
+
+func newDynamicContext(args []interface{}, naming NamingStrategy) *dynamicContext {
+	ctx := &dynamicContext{buf: new(strings.Builder), arg: paramObject(args), naming: naming}
+	// the only slice argument can be referred as "list"
+	if len(args) == 1 && isExpandable(args[0]) {
+		ctx.bindings = map[string]interface{}{"list": args[0]}
+	}
+	return ctx
+}
+
+// render dynamic sql, only the single struct or map argument is used
+func (ctx *dynamicContext) render(node sqlNode) (string, error) {
+	ctx.buf.Reset()
+	if err := node.apply(ctx); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(ctx.buf.String()), nil
+}
+
+// find values of the variables in rendered sql
+func (ctx *dynamicContext) queryArgs(vars []string, args []interface{}) ([]interface{}, error) {
+	if !ctx.arg.IsValid() && len(ctx.bindings) == 0 {
+		return parseQueryArgs(ctx.naming, vars, args...)
+	}
+	queryArgs := make([]interface{}, len(vars))
+	for i, name := range vars {
+		v, err := ctx.resolve(name, true)
+		if err != nil {
+			return nil, err
+		}
+		queryArgs[i] = v
+	}
+	return queryArgs, nil
+}
+
+// parser of sql node contents, <include> is replaced by contents of the referred <sql> fragment
+type sqlParser struct {
+	d         *xml.Decoder
+	fragments map[string]string // raw contents of <sql> fragments by id
+	including []string          // refids being included, used to find cycles
+}
+
+// parse contents of a sql node, the returned node is textNode if there is no dynamic element
+func parseSqlContents(innerXml string, fragments map[string]string) (sqlNode, error) {
+	p := &sqlParser{fragments: fragments}
+	return p.parse(innerXml)
+}
+
+func (p *sqlParser) parse(innerXml string) (sqlNode, error) {
+	p.d = xml.NewDecoder(strings.NewReader("<sql>" + innerXml + "</sql>"))
+	// skip the wrapper element
+	if _, err := p.d.Token(); err != nil {
+		return nil, err
+	}
+	return p.parseSqlNodes("sql")
+}
+
+// <include refid="..."/>
+func (p *sqlParser) parseInclude(refid string) (sqlNode, error) {
+	if err := p.skipElement("include"); err != nil {
+		return nil, err
+	}
+	if refid == "" {
+		return nil, errors.New("attribute 'refid' of <include> is missing")
+	}
+	for i, id := range p.including {
+		if id == refid {
+			cycle := append(append([]string{}, p.including[i:]...), refid)
+			return nil, errors.New(fmt.Sprintf("circular <include>: %s", strings.Join(cycle, " -> ")))
+		}
+	}
+	fragment, ok := p.fragments[refid]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("unknown refid '%s' in <include>", refid))
+	}
+
+	sub := &sqlParser{fragments: p.fragments, including: append(append([]string{}, p.including...), refid)}
+	node, err := sub.parse(fragment)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("<sql id=\"%s\">: %s", refid, err.Error()))
+	}
+	return node, nil
+}
+
+// texts not nested in dynamic elements, used to check type of statement
+func topLevelText(node sqlNode) string {
+	switch n := node.(type) {
+	case textNode:
+		return string(n)
+	case mixedNode:
+		text := ""
+		for _, child := range n {
+			text += topLevelText(child)
+		}
+		return text
+	}
+	return ""
+}
+
+// only whitespaces are allowed in the element
+func (p *sqlParser) skipElement(name string) error {
+	node, err := p.parseSqlNodes(name)
+	if err != nil {
+		return err
+	}
+	if text, ok := node.(textNode); !ok || strings.TrimSpace(string(text)) != "" {
+		return errors.New(fmt.Sprintf("element <%s> must be empty", name))
+	}
+	return nil
+}
+
+// parse nodes until the end element named by end, adjacent texts are merged
+func (p *sqlParser) parseSqlNodes(end string) (sqlNode, error) {
+	nodes := make(mixedNode, 0, 4)
+	appendText := func(s string) {
+		// line breaks and indents between elements are replaced by one space
+		s = lineBreakRegexp.ReplaceAllString(s, " ")
+		if len(nodes) > 0 {
+			if last, ok := nodes[len(nodes)-1].(textNode); ok {
+				nodes[len(nodes)-1] = last + textNode(s)
+				return
+			}
+		}
+		nodes = append(nodes, textNode(s))
+	}
+
+	for {
+		tok, err := p.d.Token()
+		if err == io.EOF {
+			return nil, errors.New(fmt.Sprintf("element <%s> is not closed", end))
+		} else if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.CharData:
+			appendText(string(t))
+		case xml.StartElement:
+			node, err := p.parseSqlElement(t)
+			if err != nil {
+				return nil, err
+			}
+			if text, ok := node.(textNode); ok {
+				appendText(string(text))
+			} else {
+				nodes = append(nodes, node)
+			}
+		case xml.EndElement:
+			switch len(nodes) {
+			case 0:
+				return textNode(""), nil
+			case 1:
+				return nodes[0], nil
+			}
+			return nodes, nil
+		}
+	}
+}
+
+func (p *sqlParser) parseSqlElement(start xml.StartElement) (sqlNode, error) {
+	name := start.Name.Local
+	attr := func(key string) string {
+		for _, a := range start.Attr {
+			if a.Name.Local == key {
+				return a.Value
+			}
+		}
+		return ""
+	}
+
+	switch name {
+	case "if":
+		return p.parseIf(start)
+	case "where":
+		contents, err := p.parseSqlNodes(name)
+		if err != nil {
+			return nil, err
+		}
+		return &trimNode{prefix: "WHERE", prefixOverrides: []string{"AND ", "OR "}, contents: contents}, nil
+	case "set":
+		contents, err := p.parseSqlNodes(name)
+		if err != nil {
+			return nil, err
+		}
+		return &trimNode{prefix: "SET", suffixOverrides: []string{","}, contents: contents}, nil
+	case "trim":
+		contents, err := p.parseSqlNodes(name)
+		if err != nil {
+			return nil, err
+		}
+		return &trimNode{
+			prefix:          attr("prefix"),
+			suffix:          attr("suffix"),
+			prefixOverrides: splitOverrides(attr("prefixOverrides")),
+			suffixOverrides: splitOverrides(attr("suffixOverrides")),
+			contents:        contents,
+		}, nil
+	case "choose":
+		return p.parseChoose()
+	case "include":
+		return p.parseInclude(strings.TrimSpace(attr("refid")))
+	case "foreach":
+		if strings.TrimSpace(attr("collection")) == "" {
+			return nil, errors.New("attribute 'collection' of <foreach> is missing")
+		}
+		contents, err := p.parseSqlNodes(name)
+		if err != nil {
+			return nil, err
+		}
+		return &foreachNode{
+			collection: strings.TrimSpace(attr("collection")),
+			item:       strings.TrimSpace(attr("item")),
+			index:      strings.TrimSpace(attr("index")),
+			open:       attr("open"),
+			separator:  attr("separator"),
+			close:      attr("close"),
+			contents:   contents,
+		}, nil
+	}
+	return nil, errors.New(fmt.Sprintf("unknown element <%s>", name))
+}
+
+// only <when> and <otherwise> are allowed in <choose>
+func (p *sqlParser) parseChoose() (sqlNode, error) {
+	node := new(chooseNode)
+	for {
+		tok, err := p.d.Token()
+		if err == io.EOF {
+			return nil, errors.New("element <choose> is not closed")
+		} else if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.CharData:
+			if strings.TrimSpace(string(t)) != "" {
+				return nil, errors.New(fmt.Sprintf("text [%s] is not allowed in <choose>", strings.TrimSpace(string(t))))
+			}
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "when":
+				if node.otherwise != nil {
+					return nil, errors.New("<when> after <otherwise> in <choose>")
+				}
+				when, err := p.parseIf(t)
+				if err != nil {
+					return nil, err
+				}
+				node.whens = append(node.whens, when)
+			case "otherwise":
+				if node.otherwise != nil {
+					return nil, errors.New("more than one <otherwise> in <choose>")
+				}
+				node.otherwise, err = p.parseSqlNodes("otherwise")
+				if err != nil {
+					return nil, err
+				}
+			default:
+				return nil, errors.New(fmt.Sprintf("element <%s> is not allowed in <choose>", t.Name.Local))
+			}
+		case xml.EndElement:
+			if len(node.whens) == 0 {
+				return nil, errors.New("<choose> must have at least one <when>")
+			}
+			return node, nil
+		}
+	}
+}
+
+// <if> and <when>
+func (p *sqlParser) parseIf(start xml.StartElement) (*ifNode, error) {
+	name, test := start.Name.Local, ""
+	for _, a := range start.Attr {
+		if a.Name.Local == "test" {
+			test = a.Value
+		}
+	}
+	if strings.TrimSpace(test) == "" {
+		return nil, errors.New(fmt.Sprintf("attribute 'test' of <%s> is missing", name))
+	}
+	e, err := parseExpr(test)
+	if err != nil {
+		return nil, err
+	}
+	contents, err := p.parseSqlNodes(name)
+	if err != nil {
+		return nil, err
+	}
+	return &ifNode{test: e, contents: contents}, nil
+}
+
+// overrides are separated by "|", for example: "AND |OR "
+func splitOverrides(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "|")
+}
@@ -0,0 +1,144 @@
+package gomapper
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// SqlMapError is a problem found when parsing sqlmap, located by the element in xml,
+// or by the unmatched "#{" or "}" of static statements, such as:
+//
+//	sql/user.xml:12:2: invalid sql 'user.selectAll': unknown resultMap 'userMap'
+type SqlMapError struct {
+	File   string // name of file, empty if not loaded from file
+	Line   int    // 1-based line in xml, 0 if unknown
+	Column int    // 1-based column in characters, 0 if unknown
+	Id     string // qualified id of statement, fragment or resultMap, empty if unknown
+	Reason string
+}
+
+func (e *SqlMapError) Error() string {
+	location := e.File
+	if location == "" {
+		location = "sqlmap"
+	}
+	if e.Line > 0 {
+		location += fmt.Sprintf(":%d", e.Line)
+	}
+	if e.Line > 0 && e.Column > 0 {
+		location += fmt.Sprintf(":%d", e.Column)
+	}
+	return location + ": " + e.Reason
+}
+
+// all problems of sqlmap files, returned by NewSqlMap, SqlMap.Load, NewSqlMapByFiles and NewSqlMapFS,
+// the first *SqlMapError can be found by errors.As
+type SqlMapErrors []*SqlMapError
+
+func (es SqlMapErrors) Error() string {
+	msgs := make([]string, len(es))
+	for i, e := range es {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func (es SqlMapErrors) Unwrap() []error {
+	errs := make([]error, len(es))
+	for i, e := range es {
+		errs[i] = e
+	}
+	return errs
+}
+
+// offsets of a child element of the ROOT node in xml
+type xmlPosition struct {
+	start int // offset of '<' of start tag
+	inner int // offset of contents after start tag
+	end   int // offset of end tag, same as inner if self-closing
+}
+
+// positions of children of the ROOT node by names in order, such as "select" -> [...]
+func elementPositions(xmlBytes []byte) (map[string][]xmlPosition, error) {
+	positions := make(map[string][]xmlPosition)
+	d := xml.NewDecoder(bytes.NewReader(xmlBytes))
+	depth := 0
+	var current xmlPosition
+	var name string
+	for {
+		offset := int(d.InputOffset())
+		token, err := d.Token()
+		if err != nil {
+			if err == io.EOF {
+				return positions, nil
+			}
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			depth++
+			if depth == 2 {
+				name = t.Name.Local
+				current = xmlPosition{start: offset, inner: int(d.InputOffset())}
+			}
+		case xml.EndElement:
+			if depth == 2 {
+				current.end = offset
+				positions[name] = append(positions[name], current)
+			}
+			depth--
+		}
+	}
+}
+
+// 1-based line and column of offset in xml
+func lineColumn(xmlBytes []byte, offset int) (int, int) {
+	if offset > len(xmlBytes) {
+		offset = len(xmlBytes)
+	}
+	before := xmlBytes[:offset]
+	lineStart := bytes.LastIndexByte(before, '\n') + 1
+	return bytes.Count(before, []byte("\n")) + 1, utf8.RuneCount(before[lineStart:]) + 1
+}
+
+// error of xml syntax, located by line of xml.SyntaxError
+func newSyntaxError(file string, xmlBytes []byte, err error) *SqlMapError {
+	e := &SqlMapError{File: file, Reason: err.Error()}
+	var syntaxErr *xml.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		e.Line, e.Reason = syntaxErr.Line, syntaxErr.Msg
+	}
+	return e
+}
+
+// offset of the first unmatched "#{" or "}" in s, -1 if all are matched
+func unmatchedBrace(s string) int {
+	off := 0
+	for {
+		i, j := strings.Index(s, "#{"), strings.IndexByte(s, '}')
+		switch {
+		case i == -1 && j == -1:
+			return -1
+		case i != -1 && j != -1 && i < j:
+			off += j + 1
+			s = s[j+1:]
+		case j != -1 && (i == -1 || j < i):
+			return off + j
+		default:
+			return off + i
+		}
+	}
+}
+
+// at most n characters of s
+func snippet(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n]) + "..."
+}
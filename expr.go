@@ -0,0 +1,479 @@
+package gomapper
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Expressions used by the "test" attribute of <if> and <when>, for example:
+//
+//	Name != nil and Name != ''
+//	Age >= 18 or (Vip and not Banned)
+//	Status == 'active'
+//
+// Supported:
+//
+//	identifiers: names of struct fields or map keys, "." can be used for nested values (User.Name)
+//	literals: nil/null, true/false, numbers, strings in single or double quotes
+//	comparisons: == != < <= > >=, or eq ne/neq lt lte/le gt gte/ge to avoid escaping in xml
+//	logical: and/&&, or/||, not/!, parentheses
+//
+// An identifier used as condition is true if its value is not nil/zero/empty.
+// Keys missing in map arguments are nil, so optional filters can be tested by "Key != nil".
+type expr interface {
+	eval(ctx *dynamicContext) (interface{}, error)
+}
+
+type literalExpr struct {
+	value interface{}
+}
+
+type identExpr struct {
+	path string
+}
+
+type notExpr struct {
+	x expr
+}
+
+type logicalExpr struct {
+	and  bool // "and" if true, "or" otherwise
+	l, r expr
+}
+
+type compareExpr struct {
+	op   string // == != < <= > >=
+	l, r expr
+}
+
+func (e *literalExpr) eval(ctx *dynamicContext) (interface{}, error) {
+	return e.value, nil
+}
+
+func (e *identExpr) eval(ctx *dynamicContext) (interface{}, error) {
+	return ctx.lookup(e.path)
+}
+
+func (e *notExpr) eval(ctx *dynamicContext) (interface{}, error) {
+	v, err := e.x.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return !truth(v), nil
+}
+
+func (e *logicalExpr) eval(ctx *dynamicContext) (interface{}, error) {
+	l, err := e.l.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// short circuit
+	if truth(l) != e.and {
+		return !e.and, nil
+	}
+	r, err := e.r.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return truth(r), nil
+}
+
+func (e *compareExpr) eval(ctx *dynamicContext) (interface{}, error) {
+	l, err := e.l.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r, err := e.r.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return compare(e.op, normalize(l), normalize(r))
+}
+
+// evaluate the expression as condition
+func evalTest(e expr, ctx *dynamicContext) (bool, error) {
+	v, err := e.eval(ctx)
+	if err != nil {
+		return false, err
+	}
+	return truth(v), nil
+}
+
+// nil, false, 0, "" and empty slices/maps are false
+func truth(v interface{}) bool {
+	v = normalize(v)
+	switch val := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return val
+	case int64:
+		return val != 0
+	case float64:
+		return val != 0
+	case string:
+		return val != ""
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return rv.Len() > 0
+	}
+	return !rv.IsZero()
+}
+
+// dereference pointers and convert basic kinds to nil/bool/int64/float64/string
+func normalize(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+
+	switch rv.Kind() {
+	case reflect.Invalid:
+		return nil
+	case reflect.Bool:
+		return rv.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u := rv.Uint()
+		if u > 1<<63-1 {
+			return float64(u)
+		}
+		return int64(u)
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	case reflect.String:
+		return rv.String()
+	case reflect.Slice, reflect.Map:
+		if rv.IsNil() {
+			return nil
+		}
+	}
+	return rv.Interface()
+}
+
+func compare(op string, l, r interface{}) (bool, error) {
+	if l == nil || r == nil {
+		switch op {
+		case "==":
+			return l == nil && r == nil, nil
+		case "!=":
+			return !(l == nil && r == nil), nil
+		}
+		// ordering with nil is always false
+		return false, nil
+	}
+
+	var c int
+	switch lv := l.(type) {
+	case int64:
+		switch rv := r.(type) {
+		case int64:
+			c = compareOrdered(lv, rv)
+		case float64:
+			c = compareOrdered(float64(lv), rv)
+		default:
+			return false, mismatchError(op, l, r)
+		}
+	case float64:
+		switch rv := r.(type) {
+		case int64:
+			c = compareOrdered(lv, float64(rv))
+		case float64:
+			c = compareOrdered(lv, rv)
+		default:
+			return false, mismatchError(op, l, r)
+		}
+	case string:
+		rv, ok := r.(string)
+		if !ok {
+			return false, mismatchError(op, l, r)
+		}
+		c = compareOrdered(lv, rv)
+	default:
+		if op != "==" && op != "!=" {
+			return false, mismatchError(op, l, r)
+		}
+		if reflect.TypeOf(l) != reflect.TypeOf(r) {
+			return false, mismatchError(op, l, r)
+		}
+		eq := reflect.DeepEqual(l, r)
+		return eq == (op == "=="), nil
+	}
+
+	switch op {
+	case "==":
+		return c == 0, nil
+	case "!=":
+		return c != 0, nil
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	case ">=":
+		return c >= 0, nil
+	}
+	return false, errors.New(fmt.Sprintf("unknown operator '%s'", op))
+}
+
+func compareOrdered[T int64 | float64 | string](l, r T) int {
+	if l < r {
+		return -1
+	} else if l > r {
+		return 1
+	}
+	return 0
+}
+
+func mismatchError(op string, l, r interface{}) error {
+	return errors.New(fmt.Sprintf("can not compare %T with %T by '%s'", l, r, op))
+}
+
+// lexer and recursive descent parser of expressions
+//
+//	or   := and { ("or" | "||") and }
+//	and  := not { ("and" | "&&") not }
+//	not  := ("not" | "!") not | cmp
+//	cmp  := primary [ op primary ]
+//	primary := "(" or ")" | literal | identifier
+type exprParser struct {
+	src    string
+	tokens []exprToken
+	pos    int
+}
+
+type exprToken struct {
+	kind  int // one of tok*
+	text  string
+	value interface{} // for literals
+}
+
+const (
+	tokEOF = iota
+	tokIdent
+	tokLiteral
+	tokOp
+	tokLParen
+	tokRParen
+)
+
+var exprKeywords = map[string]string{
+	"and": "and", "or": "or", "not": "not",
+	"eq": "==", "ne": "!=", "neq": "!=",
+	"lt": "<", "lte": "<=", "le": "<=",
+	"gt": ">", "gte": ">=", "ge": ">=",
+}
+
+func parseExpr(src string) (expr, error) {
+	tokens, err := lexExpr(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{src: src, tokens: tokens}
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokEOF {
+		return nil, p.errorf("unexpected '%s'", p.peek().text)
+	}
+	return e, nil
+}
+
+func lexExpr(src string) ([]exprToken, error) {
+	tokens := make([]exprToken, 0, 8)
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, exprToken{kind: tokLParen, text: "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, exprToken{kind: tokRParen, text: ")"})
+			i++
+		case c == '\'' || c == '"':
+			// string literal, backslash escapes the next byte
+			var buf strings.Builder
+			j := i + 1
+			for ; j < len(src) && src[j] != c; j++ {
+				if src[j] == '\\' && j+1 < len(src) {
+					j++
+				}
+				buf.WriteByte(src[j])
+			}
+			if j >= len(src) {
+				return nil, errors.New(fmt.Sprintf("unterminated string in expression [%s]", src))
+			}
+			tokens = append(tokens, exprToken{kind: tokLiteral, text: src[i : j+1], value: buf.String()})
+			i = j + 1
+		case c >= '0' && c <= '9' || c == '-' && i+1 < len(src) && src[i+1] >= '0' && src[i+1] <= '9':
+			j := i + 1
+			for j < len(src) && (src[j] >= '0' && src[j] <= '9' || src[j] == '.') {
+				j++
+			}
+			text := src[i:j]
+			var value interface{}
+			if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+				value = n
+			} else if f, err := strconv.ParseFloat(text, 64); err == nil {
+				value = f
+			} else {
+				return nil, errors.New(fmt.Sprintf("invalid number '%s' in expression [%s]", text, src))
+			}
+			tokens = append(tokens, exprToken{kind: tokLiteral, text: text, value: value})
+			i = j
+		case c == '_' || unicode.IsLetter(rune(c)):
+			j := i + 1
+			for j < len(src) && (src[j] == '_' || src[j] == '.' || unicode.IsLetter(rune(src[j])) || unicode.IsDigit(rune(src[j]))) {
+				j++
+			}
+			text := src[i:j]
+			switch lower := strings.ToLower(text); lower {
+			case "nil", "null":
+				tokens = append(tokens, exprToken{kind: tokLiteral, text: text})
+			case "true", "false":
+				tokens = append(tokens, exprToken{kind: tokLiteral, text: text, value: lower == "true"})
+			default:
+				if op, ok := exprKeywords[lower]; ok {
+					tokens = append(tokens, exprToken{kind: tokOp, text: op})
+				} else {
+					tokens = append(tokens, exprToken{kind: tokIdent, text: text})
+				}
+			}
+			i = j
+		default:
+			// operators
+			op := ""
+			for _, o := range []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!"} {
+				if strings.HasPrefix(src[i:], o) {
+					op = o
+					break
+				}
+			}
+			switch op {
+			case "":
+				return nil, errors.New(fmt.Sprintf("unexpected '%c' in expression [%s]", c, src))
+			case "&&":
+				tokens = append(tokens, exprToken{kind: tokOp, text: "and"})
+			case "||":
+				tokens = append(tokens, exprToken{kind: tokOp, text: "or"})
+			case "!":
+				tokens = append(tokens, exprToken{kind: tokOp, text: "not"})
+			default:
+				tokens = append(tokens, exprToken{kind: tokOp, text: op})
+			}
+			i += len(op)
+		}
+	}
+	return append(tokens, exprToken{kind: tokEOF, text: "end of expression"}), nil
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() exprToken {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	return errors.New(fmt.Sprintf(format, args...) + fmt.Sprintf(" in expression [%s]", p.src))
+}
+
+func (p *exprParser) parseOr() (expr, error) {
+	l, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokOp && p.peek().text == "or" {
+		p.next()
+		r, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l = &logicalExpr{and: false, l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *exprParser) parseAnd() (expr, error) {
+	l, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokOp && p.peek().text == "and" {
+		p.next()
+		r, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		l = &logicalExpr{and: true, l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *exprParser) parseNot() (expr, error) {
+	if p.peek().kind == tokOp && p.peek().text == "not" {
+		p.next()
+		x, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notExpr{x: x}, nil
+	}
+	return p.parseCompare()
+}
+
+func (p *exprParser) parseCompare() (expr, error) {
+	l, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	if t.kind != tokOp || t.text == "and" || t.text == "or" || t.text == "not" {
+		return l, nil
+	}
+	p.next()
+	r, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	return &compareExpr{op: t.text, l: l, r: r}, nil
+}
+
+func (p *exprParser) parsePrimary() (expr, error) {
+	t := p.next()
+	switch t.kind {
+	case tokLParen:
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next().kind != tokRParen {
+			return nil, p.errorf("missing ')'")
+		}
+		return e, nil
+	case tokLiteral:
+		return &literalExpr{value: t.value}, nil
+	case tokIdent:
+		return &identExpr{path: t.text}, nil
+	}
+	return nil, p.errorf("unexpected '%s'", t.text)
+}
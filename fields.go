@@ -0,0 +1,192 @@
+package gomapper
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Struct fields can be mapped to columns by tag "db":
+//
+//	UserID int64  `db:"user_id"`  // mapped to column user_id
+//	Email  string `db:"email_addr"`
+//	Cache  string `db:"-"`        // ignored
+//	Tags   []string `db:",json"`   // saved as JSON, see json.go
+//
+// Fields without tag are mapped by NamingStrategy, see naming.go.
+// Promoted fields of embedded structs are mapped as fields of the outer struct,
+// the same rules as encoding/json are used if names conflict.
+type structField struct {
+	name   string // name of field in golang
+	column string // column name in tag "db", empty if not tagged
+	index  []int  // index sequence for reflect.Value.FieldByIndex
+	typ    reflect.Type
+	json   bool // marshaled to JSON, tagged `db:",json"`
+}
+
+// cache of struct fields, reflect.Type -> []structField
+var structFieldsCache sync.Map
+
+// exported fields of struct type t, including promoted fields of embedded structs
+func structFields(t reflect.Type) []structField {
+	if fields, ok := structFieldsCache.Load(t); ok {
+		return fields.([]structField)
+	}
+	fields := typeFields(t)
+	structFieldsCache.Store(t, fields)
+	return fields
+}
+
+// find the field of "#{VarName}" by tag or naming strategy, tagged field comes first
+func fieldByName(t reflect.Type, name string, naming NamingStrategy) (structField, bool) {
+	fields := structFields(t)
+	for _, f := range fields {
+		if f.column == name {
+			return f, true
+		}
+	}
+	for _, f := range fields {
+		if naming.Match(name, f.name) {
+			return f, true
+		}
+	}
+	return structField{}, false
+}
+
+// find the field mapped to column by tag or naming strategy,
+// tagged fields are only mapped to the column in tag
+func fieldByColumn(t reflect.Type, column string, naming NamingStrategy) (structField, bool) {
+	fields := structFields(t)
+	for _, f := range fields {
+		if f.column == column {
+			return f, true
+		}
+	}
+	for _, f := range fields {
+		if f.column == "" && naming.Match(column, f.name) {
+			return f, true
+		}
+	}
+	return structField{}, false
+}
+
+// like reflect.Value.FieldByIndex, but nil embedded pointers are allocated
+func fieldByIndexAlloc(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// name and options of tag "db", such as `db:"name,opt1,opt2"`
+func parseTag(tag string) (string, []string) {
+	parts := strings.Split(tag, ",")
+	return strings.TrimSpace(parts[0]), parts[1:]
+}
+
+func hasOption(opts []string, opt string) bool {
+	for _, o := range opts {
+		if strings.TrimSpace(o) == opt {
+			return true
+		}
+	}
+	return false
+}
+
+// whether the field at index of struct type t is tagged `db:",json"`
+func isJSONField(t reflect.Type, index []int) bool {
+	_, opts := parseTag(t.FieldByIndex(index).Tag.Get("db"))
+	return hasOption(opts, "json")
+}
+
+// breadth first walk of embedded structs, fields of outer struct dominate
+func typeFields(t reflect.Type) []structField {
+	type embedded struct {
+		typ   reflect.Type
+		index []int
+	}
+
+	current := []embedded{}
+	next := []embedded{{typ: t}}
+	visited := map[reflect.Type]bool{}
+
+	var fields []structField
+	for len(next) > 0 {
+		current, next = next, current[:0]
+
+		// fields found in this depth, name -> number of fields with the name
+		count := map[string]int{}
+		var found []structField
+
+		for _, e := range current {
+			if visited[e.typ] {
+				continue
+			}
+			visited[e.typ] = true
+
+			for i := 0; i < e.typ.NumField(); i++ {
+				sf := e.typ.Field(i)
+				tag := sf.Tag.Get("db")
+				if tag == "-" {
+					continue
+				}
+				column, opts := parseTag(tag)
+				json := hasOption(opts, "json")
+
+				index := make([]int, len(e.index)+1)
+				copy(index, e.index)
+				index[len(e.index)] = i
+
+				ft := sf.Type
+				if ft.Kind() == reflect.Ptr {
+					ft = ft.Elem()
+				}
+				// embedded struct without name in tag, walk into it in next depth
+				if sf.Anonymous && column == "" && !json && ft.Kind() == reflect.Struct {
+					next = append(next, embedded{typ: ft, index: index})
+					continue
+				}
+				if !sf.IsExported() {
+					continue
+				}
+
+				f := structField{name: sf.Name, column: column, index: index, typ: sf.Type, json: json}
+				found = append(found, f)
+				count[f.key()]++
+			}
+		}
+
+		// fields of outer structs hide fields with the same name in this depth,
+		// conflicted fields in the same depth are dropped
+		for _, f := range found {
+			if count[f.key()] > 1 || dominated(fields, f) {
+				continue
+			}
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// the name used to find conflicts
+func (f structField) key() string {
+	if f.column != "" {
+		return f.column
+	}
+	return f.name
+}
+
+func dominated(fields []structField, f structField) bool {
+	for _, outer := range fields {
+		if outer.key() == f.key() {
+			return true
+		}
+	}
+	return false
+}
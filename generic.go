@@ -0,0 +1,96 @@
+package gomapper
+
+import (
+	"context"
+	"iter"
+	"reflect"
+)
+
+// Selector is implemented by *GoMapper and *GoMapperTx, used by the generic query functions:
+//
+//	record, err := gomapper.One[Record](mapper, "selectAllById", 1)
+//	records, err := gomapper.List[*Record](mapper, "selectAll")
+//	for record, err := range gomapper.Iter[Record](mapper, "selectAll") {
+//		...
+//	}
+//
+// T can be any receiver type of Rows.Scan: struct, pointer to struct, map[string]interface{},
+// map[string]string or scalar types for query with one column.
+type Selector interface {
+	SelectContext(ctx context.Context, id string, args ...interface{}) (*Rows, error)
+}
+
+// Select exactly one row, see Mapper.SelectOne
+func One[T any](m Selector, id string, args ...interface{}) (T, error) {
+	return OneContext[T](context.Background(), m, id, args...)
+}
+
+// One, the query is canceled when ctx is done
+func OneContext[T any](ctx context.Context, m Selector, id string, args ...interface{}) (T, error) {
+	var result T
+	rows, err := m.SelectContext(ctx, id, args...)
+	if err != nil {
+		return result, err
+	}
+	defer rows.Close()
+
+	value, err := rows.scanOne(id, typeOf[T]())
+	if err != nil {
+		return result, err
+	}
+	result, _ = value.Interface().(T)
+	return result, nil
+}
+
+// Select all rows, see Mapper.SelectList
+func List[T any](m Selector, id string, args ...interface{}) ([]T, error) {
+	return ListContext[T](context.Background(), m, id, args...)
+}
+
+// List, the query is canceled when ctx is done
+func ListContext[T any](ctx context.Context, m Selector, id string, args ...interface{}) ([]T, error) {
+	rows, err := m.SelectContext(ctx, id, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values, err := rows.scanAll(typeOf[T](), 0)
+	if err != nil {
+		return nil, err
+	}
+	result, _ := values.Interface().([]T)
+	return result, rows.Close()
+}
+
+// Iterate rows one by one, rows are closed when the loop ends.
+// Error of query or scanning is yielded as the last pair, with zero value of T.
+func Iter[T any](m Selector, id string, args ...interface{}) iter.Seq2[T, error] {
+	return IterContext[T](context.Background(), m, id, args...)
+}
+
+// Iter, the query is canceled when ctx is done
+func IterContext[T any](ctx context.Context, m Selector, id string, args ...interface{}) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		rows, err := m.SelectContext(ctx, id, args...)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		defer rows.Close()
+
+		err = rows.fold(typeOf[T](), true, func(value reflect.Value) bool {
+			result, _ := value.Interface().(T)
+			return yield(result, nil)
+		})
+		if err != nil {
+			yield(zero, err)
+		}
+	}
+}
+
+// reflect.Type of T, including interface types
+func typeOf[T any]() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
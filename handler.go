@@ -0,0 +1,191 @@
+package gomapper
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// TypeHandler converts values between go types and values of database driver.
+// Handlers are registered for go types, or by names and referred in xml:
+//
+//	#{Price,handler=money}                                       in sql statements
+//	<result column="price" property="Price" handler="money"/>   in resultMap
+//
+// Handlers registered for type T are used for fields and arguments of T and *T.
+type TypeHandler interface {
+	// convert go value to argument of query
+	ToDB(value interface{}) (interface{}, error)
+	// convert value returned by driver to go value, src is nil for NULL,
+	// the returned value must be assignable to the field or receiver
+	FromDB(src interface{}) (interface{}, error)
+}
+
+var interfaceType = reflect.TypeOf((*interface{})(nil)).Elem()
+
+// registered handlers of mapper, never changed after created,
+// so that scan plans built with handlers can be cached by pointer
+type typeHandlers struct {
+	byType map[reflect.Type]TypeHandler
+	byName map[string]TypeHandler
+}
+
+// copy of handlers, nil is copied as empty handlers
+func (th *typeHandlers) clone() *typeHandlers {
+	c := &typeHandlers{byType: map[reflect.Type]TypeHandler{}, byName: map[string]TypeHandler{}}
+	if th != nil {
+		for k, v := range th.byType {
+			c.byType[k] = v
+		}
+		for k, v := range th.byName {
+			c.byName[k] = v
+		}
+	}
+	return c
+}
+
+// register handler for the go type of value, such as:
+//
+//	mapper.RegisterTypeHandler(Money(0), moneyHandler{})
+func (gm *GoMapper) RegisterTypeHandler(value interface{}, h TypeHandler) {
+	handlers := gm.handlers.clone()
+	handlers.byType[reflect.TypeOf(value)] = h
+	gm.handlers = handlers
+}
+
+// register handler referred by name in xml
+func (gm *GoMapper) RegisterNamedTypeHandler(name string, h TypeHandler) {
+	handlers := gm.handlers.clone()
+	handlers.byName[name] = h
+	gm.handlers = handlers
+}
+
+// handler of type t or *T
+func (th *typeHandlers) forType(t reflect.Type) TypeHandler {
+	if th == nil || t == nil {
+		return nil
+	}
+	if h, ok := th.byType[t]; ok {
+		return h
+	}
+	if t.Kind() == reflect.Ptr {
+		return th.byType[t.Elem()]
+	}
+	return nil
+}
+
+func (th *typeHandlers) byNameErr(name string) (TypeHandler, error) {
+	if th != nil {
+		if h, ok := th.byName[name]; ok {
+			return h, nil
+		}
+	}
+	// built-in handlers, can be replaced by registering the same name
+	if name == "json" {
+		return jsonHandler{}, nil
+	}
+	return nil, errors.New(fmt.Sprintf("type handler '%s' is not registered", name))
+}
+
+// name of variable and name of handler in "#{Name,handler=name}"
+func parseVar(v string) (string, string) {
+	name, opts, _ := strings.Cut(v, ",")
+	handler := ""
+	for _, opt := range strings.Split(opts, ",") {
+		if key, value, ok := strings.Cut(opt, "="); ok && strings.TrimSpace(key) == "handler" {
+			handler = strings.TrimSpace(value)
+		}
+	}
+	return strings.TrimSpace(name), handler
+}
+
+// names of variables without options, and names of handlers
+func parseVars(vars []string) ([]string, []string) {
+	names := make([]string, len(vars))
+	handlers := make([]string, len(vars))
+	for i, v := range vars {
+		names[i], handlers[i] = parseVar(v)
+	}
+	return names, handlers
+}
+
+// convert arguments of query by handlers, names of handlers are used if the number matches
+func (th *typeHandlers) toDB(args []interface{}, names []string) ([]interface{}, error) {
+	if th == nil && !hasName(names) {
+		return args, nil
+	}
+	var converted []interface{}
+	for i, arg := range args {
+		var h TypeHandler
+		if len(names) == len(args) && names[i] != "" {
+			var err error
+			if h, err = th.byNameErr(names[i]); err != nil {
+				return nil, err
+			}
+		} else if h = th.forType(reflect.TypeOf(arg)); h == nil {
+			continue
+		}
+
+		// pointers are dereferenced unless the handler is registered for the pointer type, nil is NULL
+		value := reflect.ValueOf(arg)
+		if value.Kind() == reflect.Ptr && (th == nil || th.byType[value.Type()] == nil) {
+			if value.IsNil() {
+				arg = nil
+			} else {
+				arg = value.Elem().Interface()
+			}
+		}
+		v, err := h.ToDB(arg)
+		if err != nil {
+			return nil, err
+		}
+		if converted == nil {
+			converted = make([]interface{}, len(args))
+			copy(converted, args)
+		}
+		converted[i] = v
+	}
+	if converted == nil {
+		return args, nil
+	}
+	return converted, nil
+}
+
+func hasName(names []string) bool {
+	for _, name := range names {
+		if name != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// convert src returned by driver by handler and set to dest
+func fromDB(h TypeHandler, src interface{}, dest reflect.Value) error {
+	v, err := h.FromDB(src)
+	if err != nil {
+		return err
+	}
+	return assignValue(dest, v)
+}
+
+// set v to dest, pointer is allocated if v is assignable to the element of dest
+func assignValue(dest reflect.Value, v interface{}) error {
+	if v == nil {
+		dest.Set(reflect.Zero(dest.Type()))
+		return nil
+	}
+	value := reflect.ValueOf(v)
+	if value.Type().AssignableTo(dest.Type()) {
+		dest.Set(value)
+		return nil
+	}
+	if dest.Kind() == reflect.Ptr && value.Type().AssignableTo(dest.Type().Elem()) {
+		ptr := reflect.New(dest.Type().Elem())
+		ptr.Elem().Set(value)
+		dest.Set(ptr)
+		return nil
+	}
+	return errors.New(fmt.Sprintf("%T returned by type handler can not be assigned to %s", v, dest.Type()))
+}
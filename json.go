@@ -0,0 +1,73 @@
+package gomapper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// Fields tagged `db:",json"` are saved as JSON documents, such as:
+//
+//	type Profile struct {
+//		Id    int64
+//		Tags  []string          `db:",json"`
+//		Attrs map[string]string `db:"attributes,json"`
+//	}
+//
+// Arguments of "#{Tags}" are marshaled to JSON strings, nil maps, slices and pointers are NULL.
+// Columns are unmarshaled into the fields when scanning, NULL is the zero value.
+// The built-in handler "json" can be used for fields without tag, see handler.go:
+//
+//	#{Tags,handler=json}
+//	<result column="tags" property="Tags" handler="json"/>
+type jsonHandler struct {
+	typ reflect.Type // type of field that columns are unmarshaled into, nil for arguments
+}
+
+func (h jsonHandler) ToDB(value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	switch v := reflect.ValueOf(value); v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		}
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (h jsonHandler) FromDB(src interface{}) (interface{}, error) {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return nil, errors.New(fmt.Sprintf("can not unmarshal %T as JSON", src))
+	}
+	if h.typ == nil {
+		return nil, errors.New("type of JSON field is unknown")
+	}
+	ptr := reflect.New(h.typ)
+	if err := json.Unmarshal(data, ptr.Interface()); err != nil {
+		return nil, err
+	}
+	return ptr.Elem().Interface(), nil
+}
+
+// handler of field with type t, json handlers are bound to the type of field
+func fieldHandler(h TypeHandler, t reflect.Type) TypeHandler {
+	if jh, ok := h.(jsonHandler); ok && jh.typ == nil {
+		return jsonHandler{typ: t}
+	}
+	return h
+}
@@ -0,0 +1,118 @@
+package gomapper
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// Select all rows into the slice pointed by dest, rows are always closed.
+// Elements of slice can be struct, pointer to struct, map[string]interface{},
+// map[string]string or scalar types for query with one column, such as:
+//
+//	var records []Record
+//	err := mapper.SelectList("selectAll", &records)
+//
+// The slice is replaced only if all rows are scanned without error.
+func (m *Mapper) SelectList(id string, dest interface{}, args ...interface{}) error {
+	return m.SelectListContext(context.Background(), id, dest, args...)
+}
+
+// SelectList, the query is canceled when ctx is done
+func (m *Mapper) SelectListContext(ctx context.Context, id string, dest interface{}, args ...interface{}) error {
+	value := reflect.ValueOf(dest)
+	if value.Kind() != reflect.Ptr || value.IsNil() || value.Elem().Kind() != reflect.Slice {
+		return errors.New(fmt.Sprintf("dest of SelectList must be a non-nil pointer to slice, got %T", dest))
+	}
+	slice := value.Elem()
+
+	rows, err := m.SelectContext(ctx, id, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	result, err := rows.scanAll(slice.Type().Elem(), 0)
+	if err != nil {
+		return err
+	}
+	if err = rows.Close(); err != nil {
+		return err
+	}
+
+	slice.Set(result)
+	return nil
+}
+
+// Select exactly one row into dest, which can be any receiver of Rows.Scan.
+// sql.ErrNoRows is returned if no row is selected, error is returned if more than one row is selected.
+func (m *Mapper) SelectOne(id string, dest interface{}, args ...interface{}) error {
+	return m.SelectOneContext(context.Background(), id, dest, args...)
+}
+
+// SelectOne, the query is canceled when ctx is done
+func (m *Mapper) SelectOneContext(ctx context.Context, id string, dest interface{}, args ...interface{}) error {
+	value := reflect.ValueOf(dest)
+	if value.Kind() != reflect.Ptr || value.IsNil() {
+		return errors.New(fmt.Sprintf("dest of SelectOne must be a non-nil pointer, got %T", dest))
+	}
+
+	rows, err := m.SelectContext(ctx, id, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	result, err := rows.scanOne(id, value.Type().Elem())
+	if err != nil {
+		return err
+	}
+	value.Elem().Set(result)
+	return nil
+}
+
+// scan all rows into a slice of typ, stop if more than max values are scanned and max > 0
+// rows selected by nested result mapping are folded, see nested.go
+func (rs *Rows) scanAll(typ reflect.Type, max int) (reflect.Value, error) {
+	result := reflect.MakeSlice(reflect.SliceOf(typ), 0, 0)
+	err := rs.fold(typ, false, func(value reflect.Value) bool {
+		result = reflect.Append(result, value)
+		return max <= 0 || result.Len() <= max
+	})
+	return result, err
+}
+
+// scan the only value of typ, error if rows are folded into zero or more values
+func (rs *Rows) scanOne(id string, typ reflect.Type) (reflect.Value, error) {
+	result, err := rs.scanAll(typ, 1)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	switch result.Len() {
+	case 0:
+		return reflect.Value{}, sql.ErrNoRows
+	case 1:
+		return result.Index(0), rs.Close()
+	default:
+		return reflect.Value{}, errors.New(fmt.Sprintf("more than one row selected by '%s'", id))
+	}
+}
+
+// scan current row into a new value of typ, pointers are allocated
+func (rs *Rows) scanNew(typ reflect.Type) (reflect.Value, error) {
+	if typ.Kind() == reflect.Ptr {
+		elem := reflect.New(typ.Elem())
+		if err := rs.Scan(elem.Interface()); err != nil {
+			return reflect.Value{}, err
+		}
+		return elem, nil
+	}
+
+	elem := reflect.New(typ)
+	if err := rs.Scan(elem.Interface()); err != nil {
+		return reflect.Value{}, err
+	}
+	return elem.Elem(), nil
+}
@@ -0,0 +1,161 @@
+package gomapper
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// Load sqlmaps from fs.FS, such as embedded files or os.DirFS:
+//
+//	//go:embed sql
+//	var sqlFiles embed.FS
+//
+//	mapper, err := NewGoMapperFS(db, sqlFiles, "sql/**/*.xml")
+//
+// Patterns are matched by path.Match for each element of slash-separated paths, and "**" matches
+// zero or more directories. A pattern matching a directory loads all "*.xml" files under it.
+// Files are loaded in lexical order, each file is loaded once even if matched by many patterns.
+func NewSqlMapFS(fsys fs.FS, patterns ...string) (*SqlMap, error) {
+	files, err := globFS(fsys, patterns)
+	if err != nil {
+		return nil, err
+	}
+	return loadFiles(files, func(name string) ([]byte, error) {
+		return fs.ReadFile(fsys, name)
+	})
+}
+
+func NewGoMapperFS(db *sql.DB, fsys fs.FS, patterns ...string) (*GoMapper, error) {
+	sqlMap, err := NewSqlMapFS(fsys, patterns...)
+	if err != nil {
+		return nil, err
+	}
+	return NewGoMapperWithSqlMap(db, sqlMap), nil
+}
+
+// merge files into one SqlMap, all files are loaded and problems of all files are returned as SqlMapErrors.
+// Statements are added after the definitions of all files.
+func loadFiles(files []string, read func(name string) ([]byte, error)) (*SqlMap, error) {
+	var mapper SqlMap
+	mapper.InitMap()
+
+	loaded := make([]*sqlFile, len(files))
+	for i, name := range files {
+		xmlBytes, err := read(name)
+		if err != nil {
+			loaded[i] = &sqlFile{name: name, errs: SqlMapErrors{&SqlMapError{File: name, Reason: err.Error()}}}
+			continue
+		}
+		loaded[i] = parseSqlFile(name, xmlBytes)
+	}
+	for _, f := range loaded {
+		mapper.loadDefinitions(f)
+	}
+	var errs SqlMapErrors
+	for _, f := range loaded {
+		mapper.loadStatements(f)
+		errs = append(errs, f.errs...)
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return &mapper, nil
+}
+
+// files matched by patterns, error if a pattern is invalid or matches nothing
+func globFS(fsys fs.FS, patterns []string) ([]string, error) {
+	var files []string
+	found := make(map[string]bool)
+	for _, pattern := range patterns {
+		pattern = path.Clean(strings.TrimPrefix(pattern, "/"))
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, errors.New(fmt.Sprintf("invalid pattern '%s': %s", pattern, err.Error()))
+		}
+
+		matched := false
+		add := func(name string) {
+			matched = true
+			if !found[name] {
+				found[name] = true
+				files = append(files, name)
+			}
+		}
+		err := fs.WalkDir(fsys, globRoot(pattern), func(name string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !matchGlob(pattern, name) {
+				return nil
+			}
+			if d.IsDir() {
+				// all xml files under the directory
+				err := fs.WalkDir(fsys, name, func(name string, d fs.DirEntry, err error) error {
+					if err == nil && !d.IsDir() && strings.HasSuffix(name, ".xml") {
+						add(name)
+					}
+					return err
+				})
+				if err != nil {
+					return err
+				}
+				return fs.SkipDir
+			}
+			add(name)
+			return nil
+		})
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		if !matched {
+			return nil, errors.New(fmt.Sprintf("no sqlmap file matches pattern '%s'", pattern))
+		}
+	}
+	return files, nil
+}
+
+// directory without meta characters where walking of pattern starts
+func globRoot(pattern string) string {
+	elems := strings.Split(pattern, "/")
+	for i, elem := range elems {
+		if strings.ContainsAny(elem, `*?[\`) {
+			if i == 0 {
+				return "."
+			}
+			return path.Join(elems[:i]...)
+		}
+	}
+	return pattern
+}
+
+// whether slash-separated name matches pattern, "**" matches zero or more elements
+func matchGlob(pattern, name string) bool {
+	if pattern == "." {
+		return true
+	}
+	return matchElems(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchElems(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchElems(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
@@ -3,30 +3,65 @@
 
 package gomapper
 
-import "database/sql"
-import "regexp"
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
+)
 
 // thread-safe, can be used by cocurrent go routines
 var sqlVarsRegexp = regexp.MustCompile(`(\$\d+)|\?`)
 
-// TODO: Prepare will be added in the future
+// prepared statements are handled by Mapper, see SetStmtCache in stmt.go
 type DbDriver interface {
 	Exec(query string, args ...interface{}) (sql.Result, error)
 	Query(query string, args ...interface{}) (*sql.Rows, error)
 	QueryRow(query string, args ...interface{}) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
 }
 
 // DB can be *sql.DB and *sql.Tx
 type Mapper struct {
 	DB      DbDriver
-	sqlMap  *SqlMap
-	logFunc func(format string, args ...interface{})
+	sqlMap  *sqlMapRef
+	logFunc func(ctx context.Context, format string, args ...interface{})
+	stmts   *stmtCache     // nil if prepared statement cache is disabled
+	naming  NamingStrategy // nil if SnakeCaseNaming is used
+	plans   *scanPlanCache // nil if naming is nil
+	policy  ColumnPolicy   // policy of unknown columns, COLUMN_STRICT if not set
+
+	nullAsZero bool          // NULL is scanned as zero value
+	handlers   *typeHandlers // nil if no handler is registered
 }
 
 type GoMapper struct {
 	Mapper
 }
 
+// SqlMap used by mapper and its transactions, replaced atomically when reloaded or changed,
+// the SqlMap in use is never modified, see watch.go and registry.go
+type sqlMapRef struct {
+	current atomic.Pointer[SqlMap]
+	mu      sync.Mutex                        // serializes updates
+	changes map[string]func(sm *SqlMap) error // latest change of each id made at runtime, see registry.go
+}
+
+func newSqlMapRef(sqlMap *SqlMap) *sqlMapRef {
+	ref := new(sqlMapRef)
+	ref.current.Store(sqlMap)
+	return ref
+}
+
+func (ref *sqlMapRef) Get(id string) (*SqlElement, error) {
+	return ref.current.Load().Get(id)
+}
+
 type GoMapperTx struct {
 	Mapper
 }
@@ -36,6 +71,26 @@ type GoMapperTx struct {
 // Create an instance of *GoMapper*, defined in mapper.go
 //func NewGoMapperByFile(db *sql.DB, xmlFilePath string) (*GoMapper, error)
 //func NewGoMapper(db *sql.DB, xmlBytes []byte) (*GoMapper, error)
+//func NewGoMapperByFiles(db *sql.DB, xmlFilePaths ...string) (*GoMapper, error)
+//func NewGoMapperWithSqlMap(db *sql.DB, sqlMap *SqlMap) *GoMapper
+
+// Load sqlmaps from fs.FS by glob patterns, defined in loader.go
+//func NewGoMapperFS(db *sql.DB, fsys fs.FS, patterns ...string) (*GoMapper, error)
+//func NewSqlMapFS(fsys fs.FS, patterns ...string) (*SqlMap, error)
+
+// Reload sqlmap files when changed, defined in watch.go
+//func (gm *GoMapper) WatchFiles(interval time.Duration, xmlFilePaths ...string) (*Watcher, error)
+//func (gm *GoMapper) WatchFS(interval time.Duration, fsys fs.FS, patterns ...string) (*Watcher, error)
+//func (w *Watcher) Reload() error
+//func (w *Watcher) Stop()
+
+// Change statements at runtime, safe for concurrent use, defined in registry.go
+//func (gm *GoMapper) RegisterSql(t SqlType, id, sql string) error
+//func (gm *GoMapper) ReplaceSql(t SqlType, id, sql string) error
+//func (gm *GoMapper) RegisterXmlSql(t SqlType, id, contents string) error
+//func (gm *GoMapper) ReplaceXmlSql(t SqlType, id, contents string) error
+//func (gm *GoMapper) RemoveSql(id string) error
+//func (gm *GoMapper) Statements() []SqlElement
 
 // Exported field of *GoMapper*
 // DB: passed in by caller as an instance of *sql.DB, can be usesd directly to do begin/commit/rollback
@@ -43,6 +98,7 @@ type GoMapperTx struct {
 // Get one row from db, defined in select.go
 //func (r *gomapper.Row) Scan(dest ...interface{}) error
 //func (m *Mapper) Get(id string, args ...interface{}) (row *GoMapper.Row)
+//func (m *Mapper) GetContext(ctx context.Context, id string, args ...interface{}) (row *GoMapper.Row)
 
 // Select multi rows from db, defined in select.go
 //func (rs *gomapper.Rows) Close() error
@@ -51,15 +107,54 @@ type GoMapperTx struct {
 //func (rs *gomapper.Rows) Next() bool
 //func (rs *gomapper.Rows) Scan(dest ...interface{}) error
 //func (m *Mapper) Select(id string, args ...interface{}) (rows *GoMapper.Rows, error)
+//func (m *Mapper) SelectContext(ctx context.Context, id string, args ...interface{}) (rows *GoMapper.Rows, error)
+
+// Select rows into slice or exactly one row, defined in list.go
+//func (m *Mapper) SelectList(id string, dest interface{}, args ...interface{}) error
+//func (m *Mapper) SelectListContext(ctx context.Context, id string, dest interface{}, args ...interface{}) error
+//func (m *Mapper) SelectOne(id string, dest interface{}, args ...interface{}) error
+//func (m *Mapper) SelectOneContext(ctx context.Context, id string, dest interface{}, args ...interface{}) error
+
+// Generic query functions, m can be *GoMapper or *GoMapperTx, defined in generic.go
+//func One[T any](m Selector, id string, args ...interface{}) (T, error)
+//func OneContext[T any](ctx context.Context, m Selector, id string, args ...interface{}) (T, error)
+//func List[T any](m Selector, id string, args ...interface{}) ([]T, error)
+//func ListContext[T any](ctx context.Context, m Selector, id string, args ...interface{}) ([]T, error)
+//func Iter[T any](m Selector, id string, args ...interface{}) iter.Seq2[T, error]
+//func IterContext[T any](ctx context.Context, m Selector, id string, args ...interface{}) iter.Seq2[T, error]
 
 // DML wrapper, defined in dml.go
 //func (gm *GoMapper) Close() err error
 //func (gm *GoMapper) Begin() (gmtx *GoMapperTx, err error)
+//func (gm *GoMapper) BeginTx(ctx context.Context, opts *sql.TxOptions) (gmtx *GoMapperTx, err error)
 //func (gmtx *GoMapperTx) Commit() error
 //func (gmtx *GoMapperTx) Rollback() error
 //func (m *Mapper) Insert(id string, args ...interface{}) (sql.Result, error)
 //func (m *Mapper) Update(id string, args ...interface{}) (sql.Result, error)
 //func (m *Mapper) Delete(id string, args ...interface{}) (sql.Result, error)
+//func (m *Mapper) InsertContext(ctx context.Context, id string, args ...interface{}) (sql.Result, error)
+//func (m *Mapper) UpdateContext(ctx context.Context, id string, args ...interface{}) (sql.Result, error)
+//func (m *Mapper) DeleteContext(ctx context.Context, id string, args ...interface{}) (sql.Result, error)
+
+// Prepared statement cache, defined in stmt.go
+//func (gm *GoMapper) SetStmtCache(enabled bool) error
+
+// Naming strategy of columns and variables, defined in naming.go
+//func (gm *GoMapper) SetNamingStrategy(naming NamingStrategy)
+
+// Policy of columns not mapped to struct fields, defined in scan.go
+//func (gm *GoMapper) SetColumnPolicy(policy ColumnPolicy)
+
+// NULL scanned as zero value, defined in null.go
+//func (gm *GoMapper) SetNullAsZero(enabled bool)
+
+// Conversion between go types and driver values, defined in handler.go
+//func (gm *GoMapper) RegisterTypeHandler(value interface{}, h TypeHandler)
+//func (gm *GoMapper) RegisterNamedTypeHandler(name string, h TypeHandler)
+
+// Logging, defined in mapper.go
+//func (gm *GoMapper) SetLogger(logFunc func(format string, args ...interface{}))
+//func (gm *GoMapper) SetContextLogger(logFunc func(ctx context.Context, format string, args ...interface{}))
 
 func NewGoMapperByFile(db *sql.DB, xmlFilePath string) (*GoMapper, error) {
 	sqlMap, err := NewSqlMapByFile(xmlFilePath)
@@ -67,9 +162,7 @@ func NewGoMapperByFile(db *sql.DB, xmlFilePath string) (*GoMapper, error) {
 		return nil, err
 	}
 
-	m := new(GoMapper)
-	m.DB, m.sqlMap = db, sqlMap
-	return m, nil
+	return NewGoMapperWithSqlMap(db, sqlMap), nil
 }
 
 func NewGoMapper(db *sql.DB, xmlBytes []byte) (*GoMapper, error) {
@@ -78,13 +171,54 @@ func NewGoMapper(db *sql.DB, xmlBytes []byte) (*GoMapper, error) {
 		return nil, err
 	}
 
+	return NewGoMapperWithSqlMap(db, sqlMap), nil
+}
+
+// statements of all files are merged, use <sqlmap namespace="..."> to avoid conflicts of ids
+func NewGoMapperByFiles(db *sql.DB, xmlFilePaths ...string) (*GoMapper, error) {
+	sqlMap, err := NewSqlMapByFiles(xmlFilePaths...)
+	if err != nil {
+		return nil, err
+	}
+	return NewGoMapperWithSqlMap(db, sqlMap), nil
+}
+
+// mapper of SqlMap built by NewSqlMap and SqlMap.Load, such as:
+//
+//	sqlMap, err := NewSqlMap(userXml)
+//	err = sqlMap.Load(orderXml)
+//	mapper := NewGoMapperWithSqlMap(db, sqlMap)
+func NewGoMapperWithSqlMap(db *sql.DB, sqlMap *SqlMap) *GoMapper {
 	m := new(GoMapper)
-	m.DB, m.sqlMap = db, sqlMap
-	return m, nil
+	m.DB, m.sqlMap = db, newSqlMapRef(sqlMap)
+	return m
 }
 
 // set logger for gommaper
 // added by fengguangpu on 2014-12-16
 func (gm *GoMapper) SetLogger(logFunc func(format string, args ...interface{})) {
+	if logFunc == nil {
+		gm.logFunc = nil
+		return
+	}
+	gm.logFunc = func(ctx context.Context, format string, args ...interface{}) {
+		logFunc(format, args...)
+	}
+}
+
+// set logger which receives the context passed to the *Context methods,
+// request scoped values (trace id etc.) can be extracted from it
+func (gm *GoMapper) SetContextLogger(logFunc func(ctx context.Context, format string, args ...interface{})) {
 	gm.logFunc = logFunc
 }
+
+// print the executed statement with elasped time if logger is set
+func (m *Mapper) log(ctx context.Context, start time.Time, query string, args []interface{}) {
+	if m.logFunc == nil {
+		return
+	}
+	elaspedMs := float64(time.Since(start).Nanoseconds()) / float64(1000000)
+	sqlFormat := sqlVarsRegexp.ReplaceAllString(query, "'%v'")
+	sqlCommand := fmt.Sprintf(sqlFormat, args...)
+	m.logFunc(ctx, "\033[36;1m[%.2fms]\033[0m %s\n", elaspedMs, sqlCommand)
+}
@@ -0,0 +1,90 @@
+package gomapper
+
+import (
+	"strings"
+)
+
+// NamingStrategy decides which struct field a column or "#{VarName}" is mapped to,
+// fields with tag "db" are matched by the tag before the strategy is used.
+// Set by GoMapper.SetNamingStrategy, SnakeCaseNaming is used by default.
+type NamingStrategy interface {
+	// whether column (or name of variable) is mapped to the struct field named field
+	Match(column, field string) bool
+}
+
+// adapter to use ordinary functions as NamingStrategy
+type NamingFunc func(column, field string) bool
+
+func (f NamingFunc) Match(column, field string) bool {
+	return f(column, field)
+}
+
+var (
+	// "user_id" --> "UserId"
+	SnakeCaseNaming NamingStrategy = NamingFunc(func(column, field string) bool {
+		return SnakeToUpperCamel(column) == field
+	})
+
+	// "user_id" --> "UserID", "home_url" --> "HomeURL"
+	InitialismNaming NamingStrategy = NamingFunc(func(column, field string) bool {
+		return SnakeToGoCamel(column) == field
+	})
+
+	// "UserId" --> "UserId"
+	ExactNaming NamingStrategy = NamingFunc(func(column, field string) bool {
+		return column == field
+	})
+
+	// "userid" --> "UserId"/"UserID"
+	CaseInsensitiveNaming NamingStrategy = NamingFunc(func(column, field string) bool {
+		return strings.EqualFold(column, field)
+	})
+)
+
+// initialisms in golint
+var commonInitialisms = map[string]bool{
+	"ACL": true, "API": true, "ASCII": true, "CPU": true, "CSS": true, "DNS": true,
+	"EOF": true, "GUID": true, "HTML": true, "HTTP": true, "HTTPS": true, "ID": true,
+	"IP": true, "JSON": true, "LHS": true, "QPS": true, "RAM": true, "RHS": true,
+	"RPC": true, "SLA": true, "SMTP": true, "SQL": true, "SSH": true, "TCP": true,
+	"TLS": true, "TTL": true, "UDP": true, "UI": true, "UID": true, "UUID": true,
+	"URI": true, "URL": true, "UTF8": true, "VM": true, "XML": true, "XMPP": true,
+	"XSRF": true, "XSS": true,
+}
+
+// used to convert table field name in database to struct field name with golint initialisms
+// example: "user_id"  --> "UserID", "http_url" --> "HTTPURL"
+func SnakeToGoCamel(s string) string {
+	var buf strings.Builder
+	for _, v := range strings.Split(s, "_") {
+		if len(v) == 0 {
+			continue
+		}
+		if upper := strings.ToUpper(v); commonInitialisms[upper] {
+			buf.WriteString(upper)
+		} else {
+			buf.WriteString(strings.ToUpper(v[:1]))
+			buf.WriteString(v[1:])
+		}
+	}
+	return buf.String()
+}
+
+// naming strategy of mapper, SnakeCaseNaming if not set
+func (m *Mapper) namingStrategy() NamingStrategy {
+	if m.naming == nil {
+		return SnakeCaseNaming
+	}
+	return m.naming
+}
+
+// set naming strategy used by scanning and binding of "#{VarName}"
+func (gm *GoMapper) SetNamingStrategy(naming NamingStrategy) {
+	gm.naming = naming
+	// scan plans built by the previous strategy are dropped
+	if naming == nil {
+		gm.plans = nil
+	} else {
+		gm.plans = newScanPlanCache(naming)
+	}
+}
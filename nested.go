@@ -0,0 +1,558 @@
+package gomapper
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Rows of JOIN queries are folded into nested structs and slices, if the statement has a resultMap
+// with <association>/<collection> (see resultmap.go), or columns are aliased with "." such as:
+//
+//	SELECT u.id, u.name, a.city AS `address.city`, o.id AS `orders.id`, o.amount AS `orders.amount`
+//	FROM user u LEFT JOIN address a ON a.user_id = u.id LEFT JOIN orders o ON o.user_id = u.id
+//
+// Segments before the last one are mapped to fields of struct, pointer to struct or slice of them
+// by tag "db" and naming strategy. Rows of aliased levels are de-duplicated by the column named "id"
+// of the level, or by all columns of the level if there is no such column.
+// Levels whose columns are all NULL, such as LEFT JOIN without matched rows, are skipped.
+//
+// Rows of the same parent can be in any order for SelectList/SelectOne/List/One,
+// only adjacent rows are folded by Iter, so ORDER BY is needed for Iter.
+type nestedPlan struct {
+	typ      reflect.Type  // struct type of the level
+	index    []int         // index sequence of field in parent struct, nil for root
+	many     bool          // field is slice
+	ptr      bool          // field or element of slice is pointer
+	prefix   string        // columnPrefix of resultMap
+	autoIds  bool          // column named "id" identifies the level
+	ids      []int         // columns identifying the level, all columns are used if empty
+	columns  []int         // columns mapped to fields of the level
+	fields   [][]int       // index sequence of fields for columns
+	notNull  []bool        // NULL of columns fails with error, see null.go
+	handlers []TypeHandler // handlers converting columns, nil if not converted
+	children []*nestedPlan
+}
+
+type nestedBuilder struct {
+	plan    *scanPlan
+	columns []string
+	naming  NamingStrategy
+	opts    scanOptions
+}
+
+func newNestedPlan(typ reflect.Type, columns []string, naming NamingStrategy, opts scanOptions) (*scanPlan, error) {
+	root := &nestedPlan{typ: typ, autoIds: opts.resultMap == nil}
+	plan := &scanPlan{nested: root, holders: make([]reflect.Type, len(columns))}
+	b := &nestedBuilder{plan: plan, columns: columns, naming: naming, opts: opts}
+
+	if opts.resultMap != nil {
+		if err := b.resultMap(root, opts.resultMap); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, name := range columns {
+		if plan.holders[i] != nil {
+			continue
+		}
+		ok, err := b.column(root, i, name, name)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			continue
+		}
+
+		switch opts.policy {
+		case COLUMN_IGNORE:
+		case COLUMN_COLLECT:
+			if plan.extra == nil {
+				sf, ok := fieldByName(typ, "*", ExactNaming)
+				if !ok || sf.typ != collectMapType {
+					return nil, errors.New(fmt.Sprintf("column '%s' can not be collected, %s has no field of map[string]interface{} tagged `db:\"*\"`", name, typ))
+				}
+				plan.extra = sf.index
+			}
+		default:
+			return nil, errors.New(fmt.Sprintf("column '%s' is not mapped to any field of %s", name, typ))
+		}
+	}
+	plan.many = root.hasMany()
+	return plan, nil
+}
+
+// whether columns need to be mapped by nestedPlan
+func isNested(columns []string, rm *ResultMap) bool {
+	if rm != nil && rm.hasNested() {
+		return true
+	}
+	for _, column := range columns {
+		if strings.Contains(column, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// map columns in resultMap to the level
+func (b *nestedBuilder) resultMap(n *nestedPlan, rm *ResultMap) error {
+	if err := rm.checkType(n.typ); err != nil {
+		return err
+	}
+	for k, mappings := range [][]ResultMapping{rm.Ids, rm.Results} {
+		for _, m := range mappings {
+			i := b.find(m.Column)
+			if i < 0 {
+				continue
+			}
+			index, err := propertyIndex(n.typ, m.Property)
+			if err != nil {
+				return errors.New(fmt.Sprintf("invalid resultMap '%s': %s", rm.Id, err.Error()))
+			}
+			var h TypeHandler
+			if m.Handler != "" {
+				if h, err = b.opts.handlers.byNameErr(m.Handler); err != nil {
+					return err
+				}
+			}
+			b.add(n, i, index, k == 0, h)
+		}
+	}
+
+	for k, nested := range [][]*ResultMap{rm.Associations, rm.Collections} {
+		for _, child := range nested {
+			index, err := propertyIndex(n.typ, child.Property)
+			if err != nil {
+				return errors.New(fmt.Sprintf("invalid resultMap '%s': %s", rm.Id, err.Error()))
+			}
+			c, err := b.child(n, index, child.Property)
+			if err != nil {
+				return errors.New(fmt.Sprintf("invalid resultMap '%s': %s", rm.Id, err.Error()))
+			}
+			if c.many != (k == 1) {
+				return errors.New(fmt.Sprintf("invalid resultMap '%s': <collection> must be used for slice field '%s'", rm.Id, child.Property))
+			}
+			c.prefix = child.ColumnPrefix
+			if err = b.resultMap(c, child); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// map column i to the level, name is the rest of column relative to the level
+func (b *nestedBuilder) column(n *nestedPlan, i int, column, name string) (bool, error) {
+	// columns with columnPrefix of nested resultMap
+	for _, c := range n.children {
+		if c.prefix != "" && len(column) > len(c.prefix) && strings.EqualFold(column[:len(c.prefix)], c.prefix) {
+			if ok, err := b.column(c, i, column, column[len(c.prefix):]); ok || err != nil {
+				return ok, err
+			}
+		}
+	}
+
+	if sf, ok := fieldByColumn(n.typ, name, b.naming); ok {
+		b.add(n, i, sf.index, n.autoIds && strings.EqualFold(name, "id"), nil)
+		return true, nil
+	}
+
+	// aliased columns of nested levels, such as "orders.id"
+	k := strings.Index(name, ".")
+	if k < 0 {
+		return false, nil
+	}
+	sf, ok := fieldByColumn(n.typ, name[:k], b.naming)
+	if !ok {
+		return false, nil
+	}
+	c, err := b.child(n, sf.index, name[:k])
+	if err != nil {
+		return false, errors.New(fmt.Sprintf("column '%s' can not be mapped: %s", column, err.Error()))
+	}
+	return b.column(c, i, column, name[k+1:])
+}
+
+// nested level of the field at index, created if not found
+func (b *nestedBuilder) child(n *nestedPlan, index []int, name string) (*nestedPlan, error) {
+	for _, c := range n.children {
+		if reflect.DeepEqual(c.index, index) {
+			return c, nil
+		}
+	}
+
+	c := &nestedPlan{index: index, autoIds: true}
+	t := n.typ.FieldByIndex(index).Type
+	if t.Kind() == reflect.Slice {
+		c.many, t = true, t.Elem()
+	}
+	if t.Kind() == reflect.Ptr {
+		c.ptr, t = true, t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t == timeType {
+		return nil, errors.New(fmt.Sprintf("field '%s' of %s is not struct or slice of struct", name, n.typ))
+	}
+	c.typ = t
+	n.children = append(n.children, c)
+	return c, nil
+}
+
+func (b *nestedBuilder) add(n *nestedPlan, i int, index []int, id bool, h TypeHandler) {
+	t := n.typ.FieldByIndex(index).Type
+	if h == nil {
+		h = b.opts.handlers.forType(t)
+	}
+	if h == nil && isJSONField(n.typ, index) {
+		h = jsonHandler{}
+	}
+	if h != nil {
+		h = fieldHandler(h, t)
+	}
+	n.handlers = append(n.handlers, h)
+	n.notNull = append(n.notNull, h == nil && !b.opts.nullAsZero && !scanNullable(t))
+	// NULL is scanned as nil pointer, levels with all columns NULL are skipped
+	if h != nil {
+		t = interfaceType
+	} else if t.Kind() != reflect.Ptr {
+		t = reflect.PtrTo(t)
+	}
+	b.plan.holders[i] = t
+	n.columns = append(n.columns, i)
+	n.fields = append(n.fields, index)
+	if id {
+		n.ids = append(n.ids, i)
+	}
+}
+
+// position of column, -1 if not selected
+func (b *nestedBuilder) find(column string) int {
+	for i, name := range b.columns {
+		if strings.EqualFold(name, column) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (n *nestedPlan) hasMany() bool {
+	for _, c := range n.children {
+		if c.many || c.hasMany() {
+			return true
+		}
+	}
+	return false
+}
+
+// whether all columns of the level and nested levels are NULL
+func (n *nestedPlan) null(row []reflect.Value) bool {
+	for _, i := range n.columns {
+		if !row[i].IsNil() {
+			return false
+		}
+	}
+	for _, c := range n.children {
+		if !c.null(row) {
+			return false
+		}
+	}
+	return true
+}
+
+// values of columns identifying the level
+func (n *nestedPlan) key(row []reflect.Value) string {
+	ids := n.ids
+	if len(ids) == 0 {
+		ids = n.columns
+	}
+	var buf strings.Builder
+	for _, i := range ids {
+		if row[i].IsNil() {
+			buf.WriteString("\x01")
+		} else {
+			fmt.Fprint(&buf, row[i].Elem().Interface())
+		}
+		buf.WriteString("\x00")
+	}
+	return buf.String()
+}
+
+// a struct of the level, and nested levels folded into it
+type foldRecord struct {
+	value    reflect.Value // pointer to struct
+	children []foldChildren
+}
+
+type foldChildren struct {
+	records []*foldRecord
+	index   map[string]*foldRecord
+}
+
+func (n *nestedPlan) newRecord(row []reflect.Value) (*foldRecord, error) {
+	value := reflect.New(n.typ)
+	for j, i := range n.columns {
+		if h := n.handlers[j]; h != nil {
+			if err := fromDB(h, row[i].Interface(), fieldByIndexAlloc(value.Elem(), n.fields[j])); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if row[i].IsNil() {
+			if n.notNull[j] {
+				return nil, nullError(n.typ, n.fields[j])
+			}
+			continue
+		}
+		field := fieldByIndexAlloc(value.Elem(), n.fields[j])
+		if field.Type() == row[i].Type() {
+			field.Set(row[i])
+		} else {
+			field.Set(row[i].Elem())
+		}
+	}
+	return &foldRecord{value: value, children: make([]foldChildren, len(n.children))}, nil
+}
+
+// fold nested levels of row into record
+func (n *nestedPlan) fold(rec *foldRecord, row []reflect.Value) error {
+	for k, c := range n.children {
+		if c.null(row) {
+			continue
+		}
+		fc := &rec.children[k]
+		var child *foldRecord
+		if c.many {
+			key := c.key(row)
+			if fc.index == nil {
+				fc.index = make(map[string]*foldRecord)
+			}
+			if child = fc.index[key]; child == nil {
+				var err error
+				if child, err = c.newRecord(row); err != nil {
+					return err
+				}
+				fc.index[key] = child
+				fc.records = append(fc.records, child)
+			}
+		} else {
+			// the first row wins for association
+			if len(fc.records) == 0 {
+				r, err := c.newRecord(row)
+				if err != nil {
+					return err
+				}
+				fc.records = append(fc.records, r)
+			}
+			child = fc.records[0]
+		}
+		if err := c.fold(child, row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// set nested levels to fields of struct, returns pointer to the struct
+func (n *nestedPlan) materialize(rec *foldRecord) reflect.Value {
+	for k, c := range n.children {
+		records := rec.children[k].records
+		if len(records) == 0 {
+			continue
+		}
+		field := fieldByIndexAlloc(rec.value.Elem(), c.index)
+		if !c.many {
+			value := c.materialize(records[0])
+			if c.ptr {
+				field.Set(value)
+			} else {
+				field.Set(value.Elem())
+			}
+			continue
+		}
+		slice := reflect.MakeSlice(field.Type(), 0, len(records))
+		for _, r := range records {
+			value := c.materialize(r)
+			if !c.ptr {
+				value = value.Elem()
+			}
+			slice = reflect.Append(slice, value)
+		}
+		field.Set(slice)
+	}
+	return rec.value
+}
+
+// folds rows into records of root level
+type folder struct {
+	plan        *scanPlan
+	columns     []string
+	types       []*sql.ColumnType
+	consecutive bool // only adjacent rows are folded
+	roots       []*foldRecord
+	index       map[string]*foldRecord
+}
+
+func newFolder(rows *sql.Rows, plan *scanPlan, consecutive bool) (*folder, error) {
+	f := &folder{plan: plan, consecutive: consecutive, index: make(map[string]*foldRecord)}
+	if plan.extra != nil {
+		var err error
+		if f.columns, err = rows.Columns(); err != nil {
+			return nil, err
+		}
+		if f.types, err = rows.ColumnTypes(); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// scan current row and fold it, returns the record of root level and whether it is new
+func (f *folder) add(rows *sql.Rows) (*foldRecord, bool, error) {
+	p := f.plan
+	holders := make([]interface{}, len(p.holders))
+	row := make([]reflect.Value, len(p.holders))
+	for i, t := range p.holders {
+		if t == nil {
+			holders[i] = new(interface{})
+			continue
+		}
+		holder := reflect.New(t)
+		holders[i] = holder.Interface()
+		row[i] = holder.Elem()
+	}
+	if err := rows.Scan(holders...); err != nil {
+		return nil, false, err
+	}
+
+	root := p.nested
+	var key string
+	var rec *foldRecord
+	if p.many {
+		key = root.key(row)
+		rec = f.index[key]
+	}
+	isNew := rec == nil
+	if isNew {
+		var err error
+		if rec, err = root.newRecord(row); err != nil {
+			return nil, false, err
+		}
+		if p.many {
+			if f.consecutive {
+				f.index = map[string]*foldRecord{}
+			}
+			f.index[key] = rec
+		}
+		if !f.consecutive {
+			f.roots = append(f.roots, rec)
+		}
+		if p.extra != nil {
+			collected := make(map[string]interface{})
+			for i, t := range p.holders {
+				if t == nil {
+					collected[f.columns[i]] = convertColumnValue(*(holders[i].(*interface{})), f.types[i].DatabaseTypeName())
+				}
+			}
+			fieldByIndexAlloc(rec.value.Elem(), p.extra).Set(reflect.ValueOf(collected))
+		}
+	}
+	if err := root.fold(rec, row); err != nil {
+		return nil, false, err
+	}
+	return rec, isNew, nil
+}
+
+// scan current row into struct value with nested plan
+func (p *scanPlan) scanNested(rows *sql.Rows, value reflect.Value) error {
+	f, err := newFolder(rows, p, true)
+	if err != nil {
+		return err
+	}
+	rec, _, err := f.add(rows)
+	if err != nil {
+		return err
+	}
+	value.Set(p.nested.materialize(rec).Elem())
+	return nil
+}
+
+// scan rows into values of typ, yield is called for each value until it returns false.
+// Rows are folded if typ is struct or pointer to struct mapped by nested plan.
+func (rs *Rows) fold(typ reflect.Type, consecutive bool, yield func(reflect.Value) bool) error {
+	plan, err := rs.nestedPlan(typ)
+	if err != nil {
+		return err
+	}
+	if plan == nil {
+		for rs.Next() {
+			value, err := rs.scanNew(typ)
+			if err != nil {
+				return err
+			}
+			if !yield(value) {
+				return nil
+			}
+		}
+		return rs.Err()
+	}
+
+	f, err := newFolder(rs.rows, plan, consecutive)
+	if err != nil {
+		return err
+	}
+	value := func(rec *foldRecord) reflect.Value {
+		v := plan.nested.materialize(rec)
+		if typ.Kind() != reflect.Ptr {
+			v = v.Elem()
+		}
+		return v
+	}
+
+	var current *foldRecord
+	for rs.Next() {
+		rec, isNew, err := f.add(rs.rows)
+		if err != nil {
+			return err
+		}
+		if consecutive && isNew && current != nil && !yield(value(current)) {
+			return nil
+		}
+		current = rec
+	}
+	if err = rs.Err(); err != nil {
+		return err
+	}
+
+	if consecutive {
+		if current != nil {
+			yield(value(current))
+		}
+		return nil
+	}
+	for _, rec := range f.roots {
+		if !yield(value(rec)) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// nested plan of rows for struct type typ, nil if typ is not struct or rows are not nested
+func (rs *Rows) nestedPlan(typ reflect.Type) (*scanPlan, error) {
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct || receiverKind(reflect.New(typ).Interface()) != reflect.Struct {
+		return nil, nil
+	}
+	columns, err := rs.rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	if !isNested(columns, rs.opts.resultMap) {
+		return nil, nil
+	}
+	return rs.mapper.scanPlans().get(typ, columns, rs.opts)
+}
@@ -0,0 +1,83 @@
+package gomapper
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// NULL can be scanned into the following fields or receivers without error:
+//
+//	pointers, such as *string, nil if NULL
+//	sql.Scanner, such as sql.NullString and sql.Null[T]
+//	interface{}, nil if NULL
+//
+// Other types, such as string and int64, fail with error by default,
+// or are set to zero values if enabled by GoMapper.SetNullAsZero.
+var scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+
+// whether NULL can be scanned into value of type t
+func scanNullable(t reflect.Type) bool {
+	return t.Kind() == reflect.Ptr || t.Kind() == reflect.Interface || reflect.PtrTo(t).Implements(scannerType)
+}
+
+// set zero values for NULL when scanning into struct fields and other receivers,
+// NULL fails with error by default.
+func (gm *GoMapper) SetNullAsZero(enabled bool) {
+	gm.nullAsZero = enabled
+}
+
+// scan current row into receivers, NULL is scanned as zero value if nullAsZero,
+// receivers of types with registered handlers are converted by handlers
+func scanColumns(rows *sql.Rows, dest []interface{}, nullAsZero bool, handlers *typeHandlers) error {
+	if !nullAsZero && handlers == nil {
+		return rows.Scan(dest...)
+	}
+
+	// receivers are replaced by pointers to them, or interface{} for handlers
+	holders := make([]interface{}, len(dest))
+	converters := make([]TypeHandler, len(dest))
+	replaced := make([]bool, len(dest))
+	copy(holders, dest)
+	for i, d := range dest {
+		value := reflect.ValueOf(d)
+		if value.Kind() != reflect.Ptr || value.IsNil() {
+			continue
+		}
+		if converters[i] = handlers.forType(value.Type().Elem()); converters[i] != nil {
+			holders[i] = new(interface{})
+		} else if nullAsZero && !scanNullable(value.Type().Elem()) {
+			holders[i] = reflect.New(value.Type()).Interface()
+			replaced[i] = true
+		}
+	}
+	if err := rows.Scan(holders...); err != nil {
+		return err
+	}
+	for i := range dest {
+		if converters[i] != nil {
+			if err := fromDB(converters[i], *(holders[i].(*interface{})), reflect.ValueOf(dest[i]).Elem()); err != nil {
+				return err
+			}
+		} else if replaced[i] {
+			setNullable(reflect.ValueOf(dest[i]).Elem(), reflect.ValueOf(holders[i]).Elem())
+		}
+	}
+	return nil
+}
+
+// set value of pointer scanned from column to target, zero value if pointer is nil
+func setNullable(target, ptr reflect.Value) {
+	if ptr.IsNil() {
+		target.Set(reflect.Zero(target.Type()))
+	} else {
+		target.Set(ptr.Elem())
+	}
+}
+
+// error of NULL scanned into field of nested levels, the same as database/sql
+func nullError(t reflect.Type, index []int) error {
+	f := t.FieldByIndex(index)
+	return errors.New(fmt.Sprintf("converting NULL to %s is unsupported, field %s of %s", f.Type, f.Name, t))
+}
@@ -0,0 +1,160 @@
+package gomapper
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Statements can be registered, replaced and removed at runtime, concurrently with queries:
+//
+//	err = mapper.RegisterSql(SQL_SELECT, "report.daily", "SELECT * FROM report WHERE day=#{Day} AND cnt < #{Max}")
+//	err = mapper.ReplaceSql(SQL_SELECT, "report.daily", "SELECT * FROM report_v2 WHERE day=#{Day}")
+//	err = mapper.RemoveSql("report.daily")
+//
+// sql of RegisterSql and ReplaceSql is plain SQL with variables "#{Name}", "<" and "&" are not escaped.
+// RegisterXmlSql and ReplaceXmlSql take the contents of SQL nodes in xml, dynamic elements and <include>
+// are supported, "<" must be escaped as in xml files:
+//
+//	err = mapper.RegisterXmlSql(SQL_SELECT, "report.find", `SELECT * FROM report <where><if test="Day != ''">day=#{Day}</if></where>`)
+//
+// Changes are copy-on-write, queries running in the meantime use the statements before the change.
+// Changes are applied again when the files are reloaded by Watcher, overriding statements of the files with
+// the same ids, the reload fails if a change can not be applied, such as an <include> of removed fragment.
+
+// register a new statement of plain SQL, error if the id is defined already
+func (gm *GoMapper) RegisterSql(t SqlType, id, sql string) error {
+	return gm.register(t, &XmlSqlNode{Id: id, Sql: sql}, false)
+}
+
+// register or replace the statement of id by plain SQL
+func (gm *GoMapper) ReplaceSql(t SqlType, id, sql string) error {
+	return gm.register(t, &XmlSqlNode{Id: id, Sql: sql}, true)
+}
+
+// register a new statement of xml contents, error if the id is defined already
+func (gm *GoMapper) RegisterXmlSql(t SqlType, id, contents string) error {
+	node, err := parseXmlSql(id, contents)
+	if err != nil {
+		return err
+	}
+	return gm.register(t, node, false)
+}
+
+// register or replace the statement of id by xml contents
+func (gm *GoMapper) ReplaceXmlSql(t SqlType, id, contents string) error {
+	node, err := parseXmlSql(id, contents)
+	if err != nil {
+		return err
+	}
+	return gm.register(t, node, true)
+}
+
+// node of xml contents, parsed the same as SQL nodes in files
+func parseXmlSql(id, contents string) (*XmlSqlNode, error) {
+	var node XmlSqlNode
+	if err := xml.Unmarshal([]byte("<sql>"+contents+"</sql>"), &node); err != nil {
+		return nil, errors.New(fmt.Sprintf("invalid sql '%s': %s", id, err.Error()))
+	}
+	node.Id = id
+	return &node, nil
+}
+
+// node without Inner is static SQL, see SqlMap.Add
+func (gm *GoMapper) register(t SqlType, node *XmlSqlNode, replace bool) error {
+	id := strings.TrimSpace(node.Id)
+	put := func(sm *SqlMap) error {
+		delete(sm.Sqls, id)
+		return sm.Add(node, t)
+	}
+	if replace {
+		return gm.sqlMap.update(id, put, put)
+	}
+	return gm.sqlMap.update(id, func(sm *SqlMap) error {
+		return sm.Add(node, t)
+	}, put)
+}
+
+// remove the statement of id, error if not exists
+func (gm *GoMapper) RemoveSql(id string) error {
+	id = strings.TrimSpace(id)
+	remove := func(sm *SqlMap) error {
+		delete(sm.Sqls, id)
+		return nil
+	}
+	err := gm.sqlMap.update(id, func(sm *SqlMap) error {
+		if _, ok := sm.Sqls[id]; !ok {
+			return errors.New(fmt.Sprintf("Sql statement specified by '%s' does not exist", id))
+		}
+		return remove(sm)
+	}, remove)
+	if err == nil && gm.stmts != nil {
+		gm.stmts.remove(id)
+	}
+	return err
+}
+
+// snapshot of statements in use, sorted by id
+func (gm *GoMapper) Statements() []SqlElement {
+	sm := gm.sqlMap.current.Load()
+	elements := make([]SqlElement, 0, len(sm.Sqls))
+	for _, element := range sm.Sqls {
+		elements = append(elements, element)
+	}
+	sort.Slice(elements, func(i, j int) bool {
+		return elements[i].Id < elements[j].Id
+	})
+	return elements
+}
+
+// change a copy of SqlMap in use and replace it, nothing is changed if error is returned
+// reapply is saved as the latest change of id, which is applied to the SqlMap of reloaded files
+func (ref *sqlMapRef) update(id string, change, reapply func(sm *SqlMap) error) error {
+	ref.mu.Lock()
+	defer ref.mu.Unlock()
+
+	sm := ref.current.Load().clone()
+	if err := change(sm); err != nil {
+		return err
+	}
+	ref.current.Store(sm)
+	if ref.changes == nil {
+		ref.changes = make(map[string]func(sm *SqlMap) error)
+	}
+	ref.changes[id] = reapply
+	return nil
+}
+
+// apply changes made at runtime to sm of reloaded files and replace the SqlMap in use,
+// nothing is changed if error is returned
+func (ref *sqlMapRef) reload(sm *SqlMap) error {
+	ref.mu.Lock()
+	defer ref.mu.Unlock()
+
+	// sm is not in use yet, changes are applied in place
+	for id, change := range ref.changes {
+		if err := change(sm); err != nil {
+			return errors.New(fmt.Sprintf("apply runtime change of '%s' failed: %s", id, err.Error()))
+		}
+	}
+	ref.current.Store(sm)
+	return nil
+}
+
+// copy of maps in SqlMap, elements are shared as they are never modified
+func (sm *SqlMap) clone() *SqlMap {
+	var c SqlMap
+	c.InitMap()
+	for id, element := range sm.Sqls {
+		c.Sqls[id] = element
+	}
+	for id, fragment := range sm.fragments {
+		c.fragments[id] = fragment
+	}
+	for id, rm := range sm.resultMaps {
+		c.resultMaps[id] = rm
+	}
+	return &c
+}
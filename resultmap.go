@@ -0,0 +1,192 @@
+package gomapper
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Columns can be mapped to fields explicitly by <resultMap> under the ROOT node:
+//
+//	<resultMap id="recordMap" type="Record">
+//		<id column="id" property="Id"/>
+//		<result column="fname" property="FirstName"/>
+//		<result column="city" property="Address.City"/>
+//	</resultMap>
+//	<select id="selectRecords" resultMap="recordMap">SELECT id, fname, city FROM t</select>
+//
+// Columns are matched case-insensitively, property is the name of field in golang,
+// "." can be used to refer fields of nested structs. Columns not in resultMap are
+// mapped by tag "db" and naming strategy as usual.
+//
+// Joined rows can be folded into nested structs and slices by <association> and <collection>,
+// which have the same children as <resultMap>. Columns of them are prefixed by columnPrefix,
+// rows are de-duplicated by <id> columns, or by all columns of the level if <id> is missing:
+//
+//	<resultMap id="userMap" type="User">
+//		<id column="id" property="Id"/>
+//		<association property="Address" columnPrefix="addr_">
+//			<result column="city" property="City"/>
+//		</association>
+//		<collection property="Orders" columnPrefix="order_">
+//			<id column="id" property="Id"/>
+//		</collection>
+//	</resultMap>
+//
+// See nested.go for folding of rows.
+type XmlResult struct {
+	Column   string `xml:"column,attr"`
+	Property string `xml:"property,attr"`
+	Handler  string `xml:"handler,attr"` // name of TypeHandler, see handler.go
+}
+
+type XmlResultMap struct {
+	Id           string         `xml:"id,attr"`
+	Type         string         `xml:"type,attr"`
+	Property     string         `xml:"property,attr"`     // for <association> and <collection>
+	ColumnPrefix string         `xml:"columnPrefix,attr"` // for <association> and <collection>
+	Ids          []XmlResult    `xml:"id"`
+	Results      []XmlResult    `xml:"result"`
+	Associations []XmlResultMap `xml:"association"`
+	Collections  []XmlResultMap `xml:"collection"`
+}
+
+type ResultMapping struct {
+	Column   string
+	Property string
+	Handler  string // name of TypeHandler, empty if not set
+}
+
+type ResultMap struct {
+	Id      string
+	Type    string          // name of struct type, checked when scanning if not empty
+	Ids     []ResultMapping // columns identifying a row
+	Results []ResultMapping
+
+	Property     string       // field of parent struct, for <association> and <collection>
+	ColumnPrefix string       // prefix of columns, included in Column of mappings
+	Associations []*ResultMap // nested struct or pointer to struct
+	Collections  []*ResultMap // nested slice of struct or pointer to struct
+}
+
+// parse a XmlResultMap and save to SqlMap
+func (sm *SqlMap) AddResultMap(node *XmlResultMap) error {
+	return sm.addResultMap("", node)
+}
+
+func (sm *SqlMap) addResultMap(namespace string, node *XmlResultMap) error {
+	id := strings.TrimSpace(node.Id)
+	if id == "" {
+		return errors.New("attribute 'id' of <resultMap> is missing")
+	}
+	id = qualifyId(namespace, id)
+	if _, ok := sm.resultMaps[id]; ok {
+		return errors.New(fmt.Sprintf("duplicate <resultMap> '%s'", id))
+	}
+
+	rm, err := newResultMap(id, "", node, map[string]bool{})
+	if err != nil {
+		return err
+	}
+	sm.resultMaps[id] = rm
+	return nil
+}
+
+// parse <resultMap>, <association> and <collection> recursively,
+// columns are the lower case names of columns found in the whole resultMap
+func newResultMap(id, prefix string, node *XmlResultMap, columns map[string]bool) (*ResultMap, error) {
+	rm := &ResultMap{Id: id, Type: strings.TrimSpace(node.Type), ColumnPrefix: prefix}
+	add := func(results []XmlResult) ([]ResultMapping, error) {
+		var mappings []ResultMapping
+		for _, r := range results {
+			column, property := strings.TrimSpace(r.Column), strings.TrimSpace(r.Property)
+			if column == "" || property == "" {
+				return nil, errors.New(fmt.Sprintf("attributes 'column' and 'property' are required in <resultMap> '%s'", id))
+			}
+			column = prefix + column
+			if columns[strings.ToLower(column)] {
+				return nil, errors.New(fmt.Sprintf("duplicate column '%s' in <resultMap> '%s'", column, id))
+			}
+			columns[strings.ToLower(column)] = true
+			mappings = append(mappings, ResultMapping{Column: column, Property: property, Handler: strings.TrimSpace(r.Handler)})
+		}
+		return mappings, nil
+	}
+	nested := func(nodes []XmlResultMap, name string) ([]*ResultMap, error) {
+		var maps []*ResultMap
+		for i := range nodes {
+			property := strings.TrimSpace(nodes[i].Property)
+			if property == "" {
+				return nil, errors.New(fmt.Sprintf("attribute 'property' of <%s> is required in <resultMap> '%s'", name, id))
+			}
+			child, err := newResultMap(id+"."+property, prefix+strings.TrimSpace(nodes[i].ColumnPrefix), &nodes[i], columns)
+			if err != nil {
+				return nil, err
+			}
+			child.Property = property
+			maps = append(maps, child)
+		}
+		return maps, nil
+	}
+
+	var err error
+	if rm.Ids, err = add(node.Ids); err != nil {
+		return nil, err
+	}
+	if rm.Results, err = add(node.Results); err != nil {
+		return nil, err
+	}
+	if rm.Associations, err = nested(node.Associations, "association"); err != nil {
+		return nil, err
+	}
+	if rm.Collections, err = nested(node.Collections, "collection"); err != nil {
+		return nil, err
+	}
+	return rm, nil
+}
+
+// whether rows are folded into nested structs and slices
+func (rm *ResultMap) hasNested() bool {
+	return len(rm.Associations) > 0 || len(rm.Collections) > 0
+}
+
+// mapping of column, false if column is not in resultMap
+func (rm *ResultMap) mapping(column string) (ResultMapping, bool) {
+	for _, mappings := range [][]ResultMapping{rm.Ids, rm.Results} {
+		for _, m := range mappings {
+			if strings.EqualFold(m.Column, column) {
+				return m, true
+			}
+		}
+	}
+	return ResultMapping{}, false
+}
+
+// check whether struct type t can be scanned by resultMap
+func (rm *ResultMap) checkType(t reflect.Type) error {
+	if rm.Type == "" || rm.Type == t.Name() || rm.Type == t.String() {
+		return nil
+	}
+	return errors.New(fmt.Sprintf("resultMap '%s' is defined for %s, can not scan into %s", rm.Id, rm.Type, t))
+}
+
+// index sequence of property in struct type t, such as "Address.City"
+func propertyIndex(t reflect.Type, property string) ([]int, error) {
+	var index []int
+	for _, name := range strings.Split(property, ".") {
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			return nil, errors.New(fmt.Sprintf("property '%s' can not be found, %s is not struct", property, t))
+		}
+		sf, ok := fieldByName(t, name, ExactNaming)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("property '%s' can not be found in %s", property, t))
+		}
+		index = append(index, sf.index...)
+		t = sf.typ
+	}
+	return index, nil
+}
@@ -0,0 +1,296 @@
+package gomapper
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// what to do with columns which are not mapped to any field of the receiver struct
+type ColumnPolicy int
+
+const (
+	COLUMN_POLICY_DEFAULT ColumnPolicy = iota // policy of mapper for statements, COLUMN_STRICT for mapper
+	COLUMN_STRICT                             // scanning fails with error
+	COLUMN_IGNORE                             // columns are ignored
+	COLUMN_COLLECT                            // columns are saved in the map field tagged `db:"*"`
+)
+
+func (cp ColumnPolicy) String() string {
+	switch cp {
+	case COLUMN_POLICY_DEFAULT:
+		return "default"
+	case COLUMN_STRICT:
+		return "strict"
+	case COLUMN_IGNORE:
+		return "ignore"
+	case COLUMN_COLLECT:
+		return "collect"
+	default:
+		return "Not supported column policy"
+	}
+}
+
+// value of attribute "unknownColumns" in xml
+func ParseColumnPolicy(s string) (ColumnPolicy, error) {
+	for cp := COLUMN_POLICY_DEFAULT; cp <= COLUMN_COLLECT; cp++ {
+		if strings.EqualFold(s, cp.String()) {
+			return cp, nil
+		}
+	}
+	if s == "" {
+		return COLUMN_POLICY_DEFAULT, nil
+	}
+	return COLUMN_POLICY_DEFAULT, errors.New(fmt.Sprintf("unknown column policy '%s', should be strict/ignore/collect", s))
+}
+
+// Plan of scanning a row into struct, built once for each struct type and column set.
+// Names of columns are resolved to index sequences of fields, so that scanning a row
+// only needs to locate the fields by index and call rows.Scan.
+type scanPlan struct {
+	fields [][]int // index sequence of field for each column, nil if column is not mapped
+	extra  []int   // index sequence of the map field collecting unmapped columns, nil if not collected
+
+	// types of pointers that columns are scanned into, then set to fields,
+	// nil if columns are scanned into fields directly, see null.go
+	holders []reflect.Type
+
+	// handlers converting columns, nil if no column is converted, see handler.go
+	converters []TypeHandler
+
+	// rows are folded into nested structs and slices if not nil, see nested.go
+	nested *nestedPlan
+	many   bool // nested plan has collection
+}
+
+// options of scanning decided by statement, part of the key of scan plans
+type scanOptions struct {
+	policy     ColumnPolicy
+	resultMap  *ResultMap    // nil if resultMap is not set
+	nullAsZero bool          // NULL is scanned as zero value
+	handlers   *typeHandlers // nil if no handler is registered
+}
+
+type scanPlanKey struct {
+	typ     reflect.Type
+	columns string // names of columns joined by "\x00"
+	opts    scanOptions
+}
+
+// cache of scan plans, the naming strategy is fixed for each cache
+type scanPlanCache struct {
+	naming NamingStrategy
+	plans  sync.Map // scanPlanKey -> *scanPlan
+}
+
+// used by ScanToStruct and mappers with default naming strategy
+var defaultScanPlans = newScanPlanCache(SnakeCaseNaming)
+
+var collectMapType = reflect.TypeOf(map[string]interface{}{})
+
+func newScanPlanCache(naming NamingStrategy) *scanPlanCache {
+	return &scanPlanCache{naming: naming}
+}
+
+// find the plan in cache, build and save it if not found
+func (c *scanPlanCache) get(typ reflect.Type, columns []string, opts scanOptions) (*scanPlan, error) {
+	key := scanPlanKey{typ: typ, columns: strings.Join(columns, "\x00"), opts: opts}
+	if plan, ok := c.plans.Load(key); ok {
+		return plan.(*scanPlan), nil
+	}
+
+	plan, err := newScanPlan(typ, columns, c.naming, opts)
+	if err != nil {
+		return nil, err
+	}
+	c.plans.Store(key, plan)
+	return plan, nil
+}
+
+func newScanPlan(typ reflect.Type, columns []string, naming NamingStrategy, opts scanOptions) (*scanPlan, error) {
+	if isNested(columns, opts.resultMap) {
+		return newNestedPlan(typ, columns, naming, opts)
+	}
+
+	rm := opts.resultMap
+	if rm != nil {
+		if err := rm.checkType(typ); err != nil {
+			return nil, err
+		}
+	}
+
+	plan := &scanPlan{fields: make([][]int, len(columns))}
+	converters := make([]TypeHandler, len(columns))
+	for i, name := range columns {
+		// columns in resultMap are mapped to the properties
+		if rm != nil {
+			if m, ok := rm.mapping(name); ok {
+				index, err := propertyIndex(typ, m.Property)
+				if err != nil {
+					return nil, errors.New(fmt.Sprintf("invalid resultMap '%s': %s", rm.Id, err.Error()))
+				}
+				plan.fields[i] = index
+				if m.Handler != "" {
+					if converters[i], err = opts.handlers.byNameErr(m.Handler); err != nil {
+						return nil, err
+					}
+				}
+				continue
+			}
+		}
+
+		// find the field in the struct
+		sf, ok := fieldByColumn(typ, name, naming)
+		if ok {
+			plan.fields[i] = sf.index
+			continue
+		}
+
+		switch opts.policy {
+		case COLUMN_IGNORE:
+		case COLUMN_COLLECT:
+			if plan.extra == nil {
+				sf, ok := fieldByName(typ, "*", ExactNaming)
+				if !ok || sf.typ != collectMapType {
+					return nil, errors.New(fmt.Sprintf("column '%s' can not be collected, %s has no field of map[string]interface{} tagged `db:\"*\"`", name, typ))
+				}
+				plan.extra = sf.index
+			}
+		default:
+			return nil, errors.New(fmt.Sprintf("column '%s' is not mapped to any field of %s", name, typ))
+		}
+	}
+
+	for i, index := range plan.fields {
+		if index == nil {
+			continue
+		}
+		t := typ.FieldByIndex(index).Type
+		if converters[i] == nil {
+			converters[i] = opts.handlers.forType(t)
+		}
+		if converters[i] == nil && isJSONField(typ, index) {
+			converters[i] = jsonHandler{}
+		}
+		if converters[i] != nil {
+			converters[i] = fieldHandler(converters[i], t)
+			plan.converters = converters
+		} else if opts.nullAsZero && !scanNullable(t) {
+			if plan.holders == nil {
+				plan.holders = make([]reflect.Type, len(columns))
+			}
+			plan.holders[i] = reflect.PtrTo(t)
+		}
+	}
+	return plan, nil
+}
+
+// scan current row into struct value, value must be addressable
+func (p *scanPlan) scan(rows *sql.Rows, value reflect.Value, columns []string) error {
+	if p.nested != nil {
+		return p.scanNested(rows, value)
+	}
+
+	// slice of addresses of target fields
+	result := make([]interface{}, len(p.fields))
+	for i, index := range p.fields {
+		if index == nil {
+			// unmapped column, saved in extra field or discarded
+			result[i] = new(interface{})
+			continue
+		}
+		// locate the address of field, will be used in scan
+		field := fieldByIndexAlloc(value, index)
+		if p.converters != nil && p.converters[i] != nil {
+			result[i] = new(interface{})
+		} else if p.holders != nil && p.holders[i] != nil {
+			result[i] = reflect.New(p.holders[i]).Interface()
+		} else {
+			result[i] = field.Addr().Interface()
+		}
+	}
+	if err := rows.Scan(result...); err != nil {
+		return err
+	}
+	for i, t := range p.holders {
+		if t != nil {
+			setNullable(fieldByIndexAlloc(value, p.fields[i]), reflect.ValueOf(result[i]).Elem())
+		}
+	}
+	for i, h := range p.converters {
+		if h != nil {
+			if err := fromDB(h, *(result[i].(*interface{})), fieldByIndexAlloc(value, p.fields[i])); err != nil {
+				return errors.New(fmt.Sprintf("convert column '%s' failed: %s", columns[i], err.Error()))
+			}
+		}
+	}
+
+	if p.extra != nil {
+		extra := fieldByIndexAlloc(value, p.extra)
+		if extra.IsNil() {
+			extra.Set(reflect.MakeMap(collectMapType))
+		}
+		types, err := rows.ColumnTypes()
+		if err != nil {
+			return err
+		}
+		// values are converted as scanning into map, see scanmap.go
+		collected := extra.Interface().(map[string]interface{})
+		for i, index := range p.fields {
+			if index == nil {
+				collected[columns[i]] = convertColumnValue(*(result[i].(*interface{})), types[i].DatabaseTypeName())
+			}
+		}
+	}
+	return nil
+}
+
+// scan plans used by mapper, depends on its naming strategy
+func (m *Mapper) scanPlans() *scanPlanCache {
+	if m.plans == nil {
+		return defaultScanPlans
+	}
+	return m.plans
+}
+
+// options of scanning rows selected by statement
+func (m *Mapper) scanOptions(element *SqlElement) scanOptions {
+	return scanOptions{policy: m.columnPolicy(element), resultMap: element.ResultMap, nullAsZero: m.nullAsZero, handlers: m.handlers}
+}
+
+// column policy of statement, policy of mapper is used if not set by statement
+func (m *Mapper) columnPolicy(element *SqlElement) ColumnPolicy {
+	if element != nil && element.ColumnPolicy != COLUMN_POLICY_DEFAULT {
+		return element.ColumnPolicy
+	}
+	if m.policy == COLUMN_POLICY_DEFAULT {
+		return COLUMN_STRICT
+	}
+	return m.policy
+}
+
+// set the default column policy of statements, COLUMN_STRICT if not set
+// policy of a statement can be set by attribute "unknownColumns" in xml, such as:
+//
+//	<select id="selectAll" unknownColumns="ignore">SELECT * FROM t</select>
+func (gm *GoMapper) SetColumnPolicy(policy ColumnPolicy) {
+	gm.policy = policy
+}
+
+// scan current row into the struct pointed by arg
+func scanToStruct(rows *sql.Rows, arg interface{}, plans *scanPlanCache, opts scanOptions) error {
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	value := reflect.ValueOf(arg).Elem()
+	plan, err := plans.get(value.Type(), columns, opts)
+	if err != nil {
+		return err
+	}
+	return plan.scan(rows, value, columns)
+}
@@ -0,0 +1,92 @@
+package gomapper
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Rows can be scanned into *map[string]interface{} or *map[string]string, keys are names of columns.
+//
+// For map[string]interface{}, values returned by driver are converted by database type of columns:
+// []byte of text columns (CHAR/VARCHAR/TEXT/DECIMAL/DATETIME...) is converted to string, integer
+// and float columns are parsed to int64/uint64/float64, binary columns (BINARY/BLOB/BIT...) are kept
+// as []byte. time.Time is returned by driver if "parseTime=True" is set in DSN, NULL is nil.
+//
+// For map[string]string, values are converted by database/sql as scanning into *string, NULL is "".
+// The map is allocated if nil, existing keys are kept if not returned by the query.
+func scanToMap(rows *sql.Rows, arg interface{}) error {
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	switch dest := arg.(type) {
+	case *map[string]interface{}:
+		types, err := rows.ColumnTypes()
+		if err != nil {
+			return err
+		}
+		values := make([]interface{}, len(columns))
+		result := make([]interface{}, len(columns))
+		for i := range values {
+			result[i] = &values[i]
+		}
+		if err = rows.Scan(result...); err != nil {
+			return err
+		}
+		if *dest == nil {
+			*dest = make(map[string]interface{}, len(columns))
+		}
+		for i, column := range columns {
+			(*dest)[column] = convertColumnValue(values[i], types[i].DatabaseTypeName())
+		}
+	case *map[string]string:
+		values := make([]sql.NullString, len(columns))
+		result := make([]interface{}, len(columns))
+		for i := range values {
+			result[i] = &values[i]
+		}
+		if err = rows.Scan(result...); err != nil {
+			return err
+		}
+		if *dest == nil {
+			*dest = make(map[string]string, len(columns))
+		}
+		for i, column := range columns {
+			(*dest)[column] = values[i].String
+		}
+	default:
+		return errors.New(fmt.Sprintf("can not scan into %T, only *map[string]interface{} and *map[string]string are supported", arg))
+	}
+	return nil
+}
+
+// convert []byte returned by driver to the go type of column, other values are returned as is
+func convertColumnValue(v interface{}, dbType string) interface{} {
+	b, ok := v.([]byte)
+	if !ok {
+		return v
+	}
+
+	t := strings.ToUpper(dbType)
+	switch {
+	case strings.Contains(t, "BLOB") || strings.Contains(t, "BINARY") || t == "BIT" || t == "GEOMETRY":
+		return b
+	case strings.Contains(t, "INT"):
+		if strings.HasPrefix(t, "UNSIGNED") {
+			if n, err := strconv.ParseUint(string(b), 10, 64); err == nil {
+				return n
+			}
+		} else if n, err := strconv.ParseInt(string(b), 10, 64); err == nil {
+			return n
+		}
+	case t == "FLOAT" || t == "DOUBLE" || t == "REAL":
+		if f, err := strconv.ParseFloat(string(b), 64); err == nil {
+			return f
+		}
+	}
+	return string(b)
+}
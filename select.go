@@ -5,6 +5,7 @@ package gomapper
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -17,6 +18,7 @@ import (
 // all fields are not allowed to access by other packages
 type Row struct {
 	mapper *Mapper
+	ctx    context.Context
 	sqlId  string
 	args   []interface{}
 }
@@ -34,8 +36,17 @@ func SnakeToUpperCamel(s string) string {
 	return buf.String()
 }
 
-// extract arguments from struct by names of variables
+// extract arguments from struct or map by names of variables
+// name in tag "db" of struct field is matched first, then name of field
+// pointers are dereferenced, "." can be used to refer nested values, such as "Address.City",
+// promoted fields of embedded structs can be referred directly
+// nil pointer in the middle of path is passed as NULL, so is every variable of nil pointer to struct or map
 func ParseQueryArgs(vars []string, args ...interface{}) ([]interface{}, error) {
+	return parseQueryArgs(SnakeCaseNaming, vars, args...)
+}
+
+// ParseQueryArgs with naming strategy of mapper
+func parseQueryArgs(naming NamingStrategy, vars []string, args ...interface{}) ([]interface{}, error) {
 	varsNum := len(vars)
 	argsNum := len(args)
 	if varsNum == 0 || argsNum == 0 || argsNum > 1 {
@@ -47,17 +58,29 @@ func ParseQueryArgs(vars []string, args ...interface{}) ([]interface{}, error) {
 	queryArgs := make([]interface{}, varsNum)
 
 	value := reflect.ValueOf(arg)
+	for value.Kind() == reflect.Ptr && !value.IsNil() {
+		value = value.Elem()
+	}
 	kind := value.Kind()
+	if kind == reflect.Ptr {
+		// nil pointer, all variables are NULL if it points to struct or map
+		elem := value.Type().Elem()
+		for elem.Kind() == reflect.Ptr {
+			elem = elem.Elem()
+		}
+		if elem.Kind() == reflect.Struct || elem.Kind() == reflect.Map {
+			return queryArgs, nil
+		}
+	}
 
 	switch kind {
-	case reflect.Struct:
+	case reflect.Struct, reflect.Map:
 		for i, name := range vars {
-			field := value.FieldByName(name)
-			if field.IsValid() {
-				queryArgs[i] = field.Interface()
-			} else {
-				return queryArgs, errors.New(fmt.Sprintf("struct has no field '%s'", name))
+			arg, err := lookupArg(value, name, naming)
+			if err != nil {
+				return queryArgs, err
 			}
+			queryArgs[i] = arg
 		}
 	default:
 		// primitive type
@@ -67,97 +90,197 @@ func ParseQueryArgs(vars []string, args ...interface{}) ([]interface{}, error) {
 	return queryArgs, nil
 }
 
-func ScanToStruct(rows *sql.Rows, arg interface{}) error {
-	columns, err := rows.Columns()
-	if err != nil {
-		return err
+// key not found in map argument, evaluated as nil in expressions of dynamic sql
+type missingKeyError struct {
+	key string
+}
+
+func (e *missingKeyError) Error() string {
+	return fmt.Sprintf("map has no key '%s'", e.key)
+}
+
+// find the value named by path in struct or map, "." separates names of nested values
+// invalid value is returned if a nil pointer is met
+func lookupValue(value reflect.Value, path string, naming NamingStrategy) (reflect.Value, error) {
+	v, _, err := lookupField(value, path, naming)
+	return v, err
+}
+
+// find the argument of query named by path, fields tagged `db:",json"` are marshaled to JSON
+func lookupArg(value reflect.Value, path string, naming NamingStrategy) (interface{}, error) {
+	v, json, err := lookupField(value, path, naming)
+	if err != nil || !v.IsValid() {
+		return nil, err
 	}
+	if json {
+		return jsonHandler{}.ToDB(v.Interface())
+	}
+	return v.Interface(), nil
+}
+
+// lookupValue, and whether the value is field tagged `db:",json"`
+func lookupField(value reflect.Value, path string, naming NamingStrategy) (reflect.Value, bool, error) {
+	json := false
+	for _, name := range strings.Split(path, ".") {
+		for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+			if value.IsNil() {
+				return reflect.Value{}, false, nil
+			}
+			value = value.Elem()
+		}
 
-	// slice of addresses of target fields
-	result := make([]interface{}, len(columns))
-	for i, name := range columns {
-		// find the field in the struct
-		goName := SnakeToUpperCamel(name)
-		field := reflect.ValueOf(arg).Elem().FieldByName(goName)
-		if field.IsValid() {
-			if field.CanAddr() {
-				// locate the address of field, will be used in scan
-				result[i] = field.Addr().Interface()
-			} else {
-				return errors.New("CanAddr() is false in ScanToStruct")
+		switch value.Kind() {
+		case reflect.Struct:
+			// name in tag "db" or name of field
+			sf, ok := fieldByName(value.Type(), name, naming)
+			if !ok {
+				return reflect.Value{}, false, errors.New(fmt.Sprintf("struct %s has no field '%s'", value.Type(), name))
 			}
-		} else {
-			return errors.New("IsValid() is false in ScanToStruct")
+			// promoted field through nil embedded pointer is nil
+			field, err := value.FieldByIndexErr(sf.index)
+			if err != nil {
+				return reflect.Value{}, false, nil
+			}
+			value, json = field, sf.json
+		case reflect.Map:
+			keyType := value.Type().Key()
+			if keyType.Kind() != reflect.String {
+				return reflect.Value{}, false, errors.New(fmt.Sprintf("map key must be string, not %s", keyType))
+			}
+			item := value.MapIndex(reflect.ValueOf(name).Convert(keyType))
+			if !item.IsValid() {
+				return item, false, &missingKeyError{key: name}
+			}
+			value, json = item, false
+		default:
+			return reflect.Value{}, false, errors.New(fmt.Sprintf("can not find '%s' in %s", name, value.Type()))
 		}
 	}
-	return rows.Scan(result...)
+	return value, json, nil
+}
+
+// columns are mapped to fields by tag "db" or SnakeToUpperCamel, see fields.go
+// plans of scanning are cached for each struct type and column set, see scan.go
+func ScanToStruct(rows *sql.Rows, arg interface{}) error {
+	return scanToStruct(rows, arg, defaultScanPlans, scanOptions{policy: COLUMN_STRICT})
 }
 
 // Get one row
 func (m *Mapper) Get(id string, args ...interface{}) *Row {
-	return &Row{sqlId: id, args: args, mapper: m}
+	return m.GetContext(context.Background(), id, args...)
+}
+
+// Get one row, the query is canceled when ctx is done
+func (m *Mapper) GetContext(ctx context.Context, id string, args ...interface{}) *Row {
+	return &Row{sqlId: id, args: args, mapper: m, ctx: ctx}
 }
 
 // *Scan* is the only method defined in interface *Scaner* in package *sql*
 // only the following types are allowed to be passed
 //  int64/float64/bool/[]byte/string/time.Time/nil
 //
-// We override this method to support *struct*
+// We override this method to support *struct*, *map[string]interface{} and *map[string]string
 func (r *Row) Scan(dest ...interface{}) error {
 	element, err := r.mapper.sqlMap.Get(r.sqlId)
 	if err != nil {
 		return err
 	}
 
-	sqlArgs, err := ParseQueryArgs(element.Vars, r.args...)
+	query, sqlArgs, err := element.bind(r.args, r.mapper.namingStrategy(), r.mapper.handlers)
 	if err != nil {
 		return err
 	}
 
-	var start int64
-	if r.mapper.logFunc != nil {
-		start = time.Now().UnixNano()
-	}
-
 	// Use Query instead QueryRow here to get names of selected columns
-	rows, err := r.mapper.DB.Query(element.Sql, sqlArgs...)
+	start := time.Now()
+	rows, release, err := r.mapper.queryContext(r.ctx, element, query, sqlArgs)
+	r.mapper.log(r.ctx, start, query, sqlArgs)
 	if err != nil {
 		return err
 	}
+	defer release()
 	defer rows.Close()
 
-	if r.mapper.logFunc != nil && start != 0 {
-		end := time.Now().UnixNano()
-		elaspedMs := float64(end-start) / float64(1000000)
-		sqlFormat := sqlVarsRegexp.ReplaceAllString(element.Sql, "'%v'")
-		sqlCommand := fmt.Sprintf(sqlFormat, sqlArgs...)
-		r.mapper.logFunc("\033[36;1m[%.2fms]\033[0m %s\n", elaspedMs, sqlCommand)
+	// the first argument can tell whether target receiver is struct or map
+	arg := dest[0]
+	kind := receiverKind(arg)
+
+	// joined rows of nested result are folded, the first struct is scanned, see nested.go
+	if kind == reflect.Struct {
+		rs := &Rows{rows: rows, mapper: r.mapper, opts: r.mapper.scanOptions(element)}
+		value := reflect.ValueOf(arg).Elem()
+		plan, err := rs.nestedPlan(value.Type())
+		if err != nil {
+			return err
+		}
+		if plan != nil {
+			found := false
+			err = rs.fold(value.Type(), false, func(v reflect.Value) bool {
+				value.Set(v)
+				found = true
+				return false
+			})
+			if err == nil && !found {
+				err = sql.ErrNoRows
+			}
+			return err
+		}
 	}
 
 	if !rows.Next() {
 		return sql.ErrNoRows
 	}
 
-	// the first argument can tell whether target receiver is struct or map
-	arg := dest[0]
-	kind := reflect.Indirect(reflect.ValueOf(arg)).Kind()
-
 	switch kind {
 	case reflect.Struct:
-		err = ScanToStruct(rows, arg)
+		err = scanToStruct(rows, arg, r.mapper.scanPlans(), r.mapper.scanOptions(element))
+	case reflect.Map:
+		err = scanToMap(rows, arg)
 	default:
-		err = rows.Scan(dest...)
+		err = scanColumns(rows, dest, r.mapper.nullAsZero, r.mapper.handlers)
 	}
 	return err
 }
 
+var timeType = reflect.TypeOf(time.Time{})
+
+// kind of the value pointed by receiver, time.Time and sql.Scanner are scanned as one column
+func receiverKind(arg interface{}) reflect.Kind {
+	if _, ok := arg.(sql.Scanner); ok {
+		return reflect.Invalid
+	}
+	value := reflect.Indirect(reflect.ValueOf(arg))
+	if !value.IsValid() || value.Type() == timeType {
+		return reflect.Invalid
+	}
+	return value.Kind()
+}
+
 // for mutli rows query
 type Rows struct {
-	rows *sql.Rows // not allowed to access by other packages
+	rows    *sql.Rows // not allowed to access by other packages
+	mapper  *Mapper
+	release func() // releases the prepared statement when rows are closed, nil if released
+
+	// plan of scanning into struct, columns are the same for all rows
+	plan     *scanPlan
+	planType reflect.Type
+	columns  []string
+	opts     scanOptions // decided by statement
 }
 
 func (rs *Rows) Close() error {
-	return rs.rows.Close()
+	err := rs.rows.Close()
+	rs.done()
+	return err
+}
+
+func (rs *Rows) done() {
+	if rs.release != nil {
+		release := rs.release
+		rs.release = nil
+		release()
+	}
 }
 
 func (rs *Rows) Columns() ([]string, error) {
@@ -169,42 +292,73 @@ func (rs *Rows) Err() error {
 }
 
 func (rs *Rows) Next() bool {
-	return rs.rows.Next()
+	if rs.rows.Next() {
+		return true
+	}
+	rs.done()
+	return false
 }
 
 // Select multi rows
 func (m *Mapper) Select(id string, args ...interface{}) (*Rows, error) {
+	return m.SelectContext(context.Background(), id, args...)
+}
+
+// Select multi rows, the query is canceled when ctx is done
+func (m *Mapper) SelectContext(ctx context.Context, id string, args ...interface{}) (*Rows, error) {
 	element, err := m.sqlMap.Get(id)
 	if err != nil {
 		return nil, err
 	}
 
-	sqlArgs, err := ParseQueryArgs(element.Vars, args...)
+	query, sqlArgs, err := element.bind(args, m.namingStrategy(), m.handlers)
 	if err != nil {
 		return nil, err
 	}
-	rows, err := m.DB.Query(element.Sql, sqlArgs...)
 
-	return &Rows{rows: rows}, err
+	start := time.Now()
+	rows, release, err := m.queryContext(ctx, element, query, sqlArgs)
+	m.log(ctx, start, query, sqlArgs)
+
+	return &Rows{rows: rows, mapper: m, release: release, opts: m.scanOptions(element)}, err
 }
 
 // *Scan* is the only method defined in interface *Scaner* in package *sql*
 // only the following types are allowed to be passed
 //  int64/float64/bool/[]byte/string/time.Time/nil
 //
-// We override this method to support *struct*
+// We override this method to support *struct*, *map[string]interface{} and *map[string]string
 func (rs *Rows) Scan(dest ...interface{}) error {
 	var err error
 	arg := dest[0]
 
-	kind := reflect.Indirect(reflect.ValueOf(arg)).Kind()
+	kind := receiverKind(arg)
 
 	switch kind {
 	case reflect.Struct:
-		err = ScanToStruct(rs.rows, arg)
+		err = rs.scanStruct(arg)
+	case reflect.Map:
+		err = scanToMap(rs.rows, arg)
 	default:
-		err = rs.rows.Scan(dest...)
+		err = scanColumns(rs.rows, dest, rs.opts.nullAsZero, rs.opts.handlers)
 	}
 
 	return err
 }
+
+// scan into struct with the plan built by the first row
+func (rs *Rows) scanStruct(arg interface{}) error {
+	value := reflect.ValueOf(arg).Elem()
+	if rs.plan == nil || rs.planType != value.Type() {
+		columns, err := rs.rows.Columns()
+		if err != nil {
+			return err
+		}
+		plan, err := rs.mapper.scanPlans().get(value.Type(), columns, rs.opts)
+		if err != nil {
+			return err
+		}
+		rs.plan, rs.planType, rs.columns = plan, value.Type(), columns
+	}
+	return rs.plan.scan(rs.rows, value, rs.columns)
+}
@@ -11,13 +11,59 @@ package gomapper
 // The ROOT node name MUST be "sqlmap", DO Not change!
 // Only four types of SQL node is supported: select/insert/update/delete, others will be ignored.
 // The type specified by the SQL node MUST match the SQL statement, parser will find mismatch and report error.
+// Leading comments and parentheses are skipped, "WITH ..." is checked by the statement after common table
+// expressions, REPLACE is INSERT, see SqlTypeOf in sqlmap.go.
+// Ids of SQL nodes MUST be unique, ids are qualified by <sqlmap namespace="user"> as "user.selectAll", so that
+// statements of many files can be loaded into one mapper by NewGoMapperByFiles or SqlMap.Load.
+// Files can also be loaded from fs.FS (embed.FS, os.DirFS) by glob patterns like "sql/**/*.xml", see loader.go.
+// Parser reports all problems of the files at once as SqlMapErrors, each located by file, line and column,
+// see errors.go.
 //
-// Passed in variables must defined in the format of "#{VarName}", passed in struct should have field named "VarName".
+// Passed in variables must defined in the format of "#{VarName}", passed in struct should have field named "VarName",
+// passed in map should have key "VarName". Pointers are dereferenced, nested values can be referred as
+// "#{Address.City}", promoted fields of embedded structs as "#{FieldName}", nil pointer is passed as NULL.
 // Receiver struct MUST have the fields whose names are the "UpperCamel" case of the target table fields.
 //  For example:
 //      SELECT id, phone_number, email_addr as email FROM t WHERE name=#{Name}
 //  Passed in struct must have a field named "Name"
 //  Receiver struct must have fields named "Id", "PhoneNmuber" and "Email"
+// Tag "db" can be used to map a field to column with different name, `db:"-"` means the field is ignored.
+//  For example:
+//      UserID int64  `db:"user_id"`
+//      Email  string `db:"email_addr"`
+// Naming convention can be changed by GoMapper.SetNamingStrategy, see naming.go.
+// Columns not mapped to any field are reported as error by default, attribute unknownColumns="ignore" of the
+// SQL node skips them, unknownColumns="collect" saves them in the field `db:"*"` of map[string]interface{}.
+// Default policy of all SQL nodes can be changed by GoMapper.SetColumnPolicy.
+// Receiver can also be *map[string]interface{} or *map[string]string, keys are names of columns, see scanmap.go.
+// Columns can be mapped to fields explicitly by <resultMap id="..." type="..."> under the ROOT node, with
+// children <id column="..." property="..."/> and <result column="..." property="..."/>, referred by
+// <select resultMap="...">. Columns not in the resultMap are mapped as usual, see resultmap.go.
+// Rows of JOIN queries are folded into nested structs and slices by <association property="..." columnPrefix="...">
+// and <collection property="..." columnPrefix="..."> in resultMap, or by columns aliased as "address.city",
+// "orders.id", rows are de-duplicated by id columns, see nested.go.
+// NULL can be scanned into pointer fields (nil), sql.Scanner such as sql.NullString and sql.Null[T], other fields
+// fail with error unless GoMapper.SetNullAsZero(true) is called, which sets zero values for NULL, see null.go.
+// Values of custom types are converted by TypeHandler registered for the go type, or referred by name as
+// "#{Price,handler=money}" in SQL nodes and <result column="..." property="..." handler="money"/>, see handler.go.
+// Fields tagged `db:",json"` are marshaled to JSON as arguments and unmarshaled from columns, NULL is the zero
+// value. Fields without tag can use the built-in handler "json", such as "#{Tags,handler=json}", see json.go.
+//
+// Reusable fragments are defined by <sql id="..."> under the ROOT node, and included by <include refid="..."/>
+// in any SQL node or fragment. Unknown refid and circular include are reported by parser.
+//  For example:
+//      <sql id="columns">id, first_name, last_name</sql>
+//      <select id="selectAll">SELECT <include refid="columns"/> FROM t</select>
+//
+// Dynamic elements can be nested in SQL nodes, the statement is rendered against the passed in struct or map:
+//      <if test="...">, <where>, <set>, <trim>, <choose>/<when>/<otherwise>, <foreach>
+//  For example:
+//      SELECT * FROM t <where><if test="Name != ''">AND name=#{Name}</if></where>
+//  See dynamic.go for elements and expr.go for expressions of "test".
+//  Comparison operators "<" and ">" must be escaped in xml, use "lt"/"gt" instead.
+//
+// Slice passed to "#{VarName}" is expanded to multiple "?", for example:
+//      SELECT * FROM t WHERE id IN (#{Ids})  -->  SELECT * FROM t WHERE id IN (?, ?, ?)
 //
 // Try to avoid using back quote(`) in SQL statements, as it is forbiddend in raw string in Golang.
 // Split the previous raw string into 2 and add contents in the middle if back quote must be used.
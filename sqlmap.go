@@ -4,11 +4,13 @@
 package gomapper
 
 import (
+	"database/sql/driver"
 	"encoding/xml"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"reflect"
 	"strings"
 )
 
@@ -39,31 +41,102 @@ func (st SqlType) String() string {
 }
 
 type XmlSqlNode struct {
-	Id  string `xml:"id,attr"`
-	Sql string `xml:",chardata"`
+	Id             string `xml:"id,attr"`
+	UnknownColumns string `xml:"unknownColumns,attr"` // strict/ignore/collect, see ColumnPolicy
+	ResultMap      string `xml:"resultMap,attr"`      // id of <resultMap>, see resultmap.go
+	Sql            string `xml:",chardata"`
+	Inner          string `xml:",innerxml"` // raw contents including dynamic elements
 }
 
 type XmlSqls struct {
-	XMLName xml.Name     `xml:"sqlmap"`
-	Selects []XmlSqlNode `xml:"select"`
-	Inserts []XmlSqlNode `xml:"insert"`
-	Updates []XmlSqlNode `xml:"update"`
-	Deletes []XmlSqlNode `xml:"delete"`
+	XMLName    xml.Name       `xml:"sqlmap"`
+	Namespace  string         `xml:"namespace,attr"` // prefix of ids, such as "user" in "user.selectAll"
+	Fragments  []XmlSqlNode   `xml:"sql"`            // reusable fragments referred by <include refid="..."/>
+	ResultMaps []XmlResultMap `xml:"resultMap"`
+	Selects    []XmlSqlNode   `xml:"select"`
+	Inserts    []XmlSqlNode   `xml:"insert"`
+	Updates    []XmlSqlNode   `xml:"update"`
+	Deletes    []XmlSqlNode   `xml:"delete"`
 }
 
 type SqlElement struct {
-	Id   string   // unique name
-	Sql  string   // sql statement
+	Id   string   // unique name, qualified by namespace if defined, such as "user.selectAll"
+	Sql  string   // sql statement, raw xml contents for dynamic sql
 	Type SqlType  // type of statement: insert/update/delete/select
-	Vars []string // names of variables that needed to be passed
+	Vars []string // names of variables that needed to be passed, nil for dynamic sql
+
+	ColumnPolicy ColumnPolicy // policy of columns not mapped to struct, policy of mapper if default
+	ResultMap    *ResultMap   // explicit mapping of columns, nil if not set
+
+	dynamic  sqlNode  // rendered at call time, nil for static sql
+	handlers []string // type handlers of Vars, such as "money" of "#{Price,handler=money}", nil if not set
 }
 
+// SqlMap is not safe for concurrent modification, it should not be changed after used by a mapper,
+// use GoMapper.RegisterSql etc. to change statements at runtime, see registry.go
 type SqlMap struct {
 	Sqls map[string]SqlElement
+
+	fragments  map[string]string     // raw contents of <sql> fragments
+	resultMaps map[string]*ResultMap // <resultMap> referred by statements
 }
 
 func (sm *SqlMap) InitMap() {
 	sm.Sqls = make(map[string]SqlElement)
+	sm.fragments = make(map[string]string)
+	sm.resultMaps = make(map[string]*ResultMap)
+}
+
+// id qualified by namespace, ids without namespace are not changed
+func qualifyId(namespace, id string) string {
+	if namespace == "" {
+		return id
+	}
+	return namespace + "." + id
+}
+
+// fragments that can be included in namespace, fragments of the namespace are also referred without namespace
+func (sm *SqlMap) fragmentsOf(namespace string) map[string]string {
+	if namespace == "" {
+		return sm.fragments
+	}
+	fragments := make(map[string]string, len(sm.fragments))
+	for id, fragment := range sm.fragments {
+		fragments[id] = fragment
+	}
+	prefix := namespace + "."
+	for id, fragment := range sm.fragments {
+		if strings.HasPrefix(id, prefix) {
+			fragments[id[len(prefix):]] = fragment
+		}
+	}
+	return fragments
+}
+
+// resultMap referred in namespace, resultMap of the namespace is found first
+func (sm *SqlMap) resultMapOf(namespace, id string) *ResultMap {
+	if rm, ok := sm.resultMaps[qualifyId(namespace, id)]; ok {
+		return rm
+	}
+	return sm.resultMaps[id]
+}
+
+// save a <sql> fragment, which can be included by statements added later
+func (sm *SqlMap) AddFragment(node *XmlSqlNode) error {
+	return sm.addFragment("", node)
+}
+
+func (sm *SqlMap) addFragment(namespace string, node *XmlSqlNode) error {
+	id := strings.Trim(node.Id, " ")
+	if id == "" {
+		return errors.New("attribute 'id' of <sql> is missing")
+	}
+	id = qualifyId(namespace, id)
+	if _, ok := sm.fragments[id]; ok {
+		return errors.New(fmt.Sprintf("duplicate <sql> fragment '%s'", id))
+	}
+	sm.fragments[id] = node.Inner
+	return nil
 }
 
 func (sm *SqlMap) Get(id string) (*SqlElement, error) {
@@ -77,40 +150,333 @@ func (sm *SqlMap) Get(id string) (*SqlElement, error) {
 // parse a XmlSqlNode and save to SqlMapper
 // SqlType must be checked
 func (sm *SqlMap) Add(node *XmlSqlNode, t SqlType) error {
+	return sm.add("", node, t)
+}
+
+// ids of statement, <include refid> and resultMap are resolved in namespace
+func (sm *SqlMap) add(namespace string, node *XmlSqlNode, t SqlType) error {
 	id := strings.Trim(node.Id, " ")
+	if id == "" {
+		return errors.New(fmt.Sprintf("attribute 'id' of <%s> is missing", strings.ToLower(t.String())))
+	}
+	id = qualifyId(namespace, id)
+	if _, ok := sm.Sqls[id]; ok {
+		return errors.New(fmt.Sprintf("duplicate sql '%s'", id))
+	}
 
-	// parse and check sql type
-	sql := strings.Trim(strings.Replace(node.Sql, "\n", " ", -1), " ")
-	err := CheckSqlType(sql, t)
+	policy, err := ParseColumnPolicy(strings.TrimSpace(node.UnknownColumns))
 	if err != nil {
-		return err
+		return errors.New(fmt.Sprintf("invalid sql '%s': %s", id, err.Error()))
+	}
+
+	var rm *ResultMap
+	if name := strings.TrimSpace(node.ResultMap); name != "" {
+		if t != SQL_SELECT {
+			return errors.New(fmt.Sprintf("invalid sql '%s': resultMap is only allowed in <select>", id))
+		}
+		if rm = sm.resultMapOf(namespace, name); rm == nil {
+			return errors.New(fmt.Sprintf("invalid sql '%s': unknown resultMap '%s'", id, name))
+		}
+	}
+
+	// parse dynamic elements and replace <include> with fragments
+	text := node.Sql
+	var dynamic sqlNode
+	if strings.Contains(node.Inner, "<") {
+		contents, err := parseSqlContents(node.Inner, sm.fragmentsOf(namespace))
+		if err != nil {
+			return errors.New(fmt.Sprintf("invalid sql '%s': %s", id, err.Error()))
+		}
+		if static, ok := contents.(textNode); ok {
+			text = string(static)
+		} else {
+			dynamic = contents
+			text = topLevelText(contents)
+		}
+	}
+
+	// parse and check sql type
+	sql := strings.Trim(strings.Replace(text, "\n", " ", -1), " ")
+	if dynamic == nil || sql != "" {
+		err := CheckSqlType(sql, t)
+		if err != nil {
+			return errors.New(fmt.Sprintf("invalid sql '%s': %s", id, err.Error()))
+		}
+	}
+
+	// statement with dynamic elements is formatted at call time
+	if dynamic != nil {
+		raw := strings.TrimSpace(strings.Replace(node.Inner, "\n", " ", -1))
+		sm.Sqls[id] = SqlElement{Id: id, Sql: raw, Type: t, ColumnPolicy: policy, ResultMap: rm, dynamic: dynamic}
+		return nil
 	}
 
 	// find variables and format sql statement
 	sql, vars, err := FormatSqlAndVars(sql)
 	if err != nil {
-		return err
+		return errors.New(fmt.Sprintf("invalid sql '%s': %s", id, err.Error()))
+	}
+
+	// options of variables are kept apart from names, such as "#{Price,handler=money}"
+	names, handlers := parseVars(vars)
+	if !hasName(handlers) {
+		handlers = nil
 	}
 
 	// add to SqlMapper
-	sm.Sqls[id] = SqlElement{Id: id, Sql: sql, Type: t, Vars: vars}
+	sm.Sqls[id] = SqlElement{Id: id, Sql: sql, Type: t, Vars: names, ColumnPolicy: policy, ResultMap: rm, handlers: handlers}
 
 	return nil
 }
 
-// sql must be trimed!
+// whether the statement has dynamic elements
+func (e *SqlElement) IsDynamic() bool {
+	return e.dynamic != nil
+}
+
+// sql statement and arguments to be executed
+func (e *SqlElement) bind(args []interface{}, naming NamingStrategy, handlers *typeHandlers) (string, []interface{}, error) {
+	sql, names, handlerNames := e.Sql, e.Vars, e.handlers
+	var ctx *dynamicContext
+	if e.dynamic != nil {
+		var err error
+		ctx = newDynamicContext(args, naming)
+		if sql, err = ctx.render(e.dynamic); err != nil {
+			return "", nil, errors.New(fmt.Sprintf("render dynamic sql '%s' failed: %s", e.Id, err.Error()))
+		}
+		var vars []string
+		if sql, vars, err = FormatSqlAndVars(sql); err != nil {
+			return "", nil, err
+		}
+		names, handlerNames = parseVars(vars)
+	}
+
+	var sqlArgs []interface{}
+	var err error
+	if ctx == nil {
+		sqlArgs, err = parseQueryArgs(naming, names, args...)
+	} else {
+		sqlArgs, err = ctx.queryArgs(names, args)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	if sqlArgs, err = handlers.toDB(sqlArgs, handlerNames); err != nil {
+		return "", nil, err
+	}
+	sql, sqlArgs = ExpandSliceArgs(sql, sqlArgs)
+	return sql, sqlArgs, nil
+}
+
+// expand slice arguments to multiple '?', for example:
+//
+//	"id IN (?)", []int64{1, 2, 3}  -->  "id IN (?, ?, ?)", 1, 2, 3
+//
+// empty slice is replaced by NULL, []byte and driver.Valuer are not expanded
+// nothing is changed if number of '?' does not match number of arguments
+func ExpandSliceArgs(sql string, args []interface{}) (string, []interface{}) {
+	expand := false
+	for _, arg := range args {
+		if isExpandable(arg) {
+			expand = true
+			break
+		}
+	}
+	if !expand {
+		return sql, args
+	}
+
+	marks := findPlaceholders(sql)
+	if len(marks) != len(args) {
+		return sql, args
+	}
+
+	var buf strings.Builder
+	expanded := make([]interface{}, 0, len(args)*2)
+	last := 0
+	for i, arg := range args {
+		if !isExpandable(arg) {
+			expanded = append(expanded, arg)
+			continue
+		}
+		buf.WriteString(sql[last:marks[i]])
+		last = marks[i] + 1
+
+		value := reflect.ValueOf(arg)
+		if value.Len() == 0 {
+			buf.WriteString("NULL")
+			continue
+		}
+		for j := 0; j < value.Len(); j++ {
+			if j > 0 {
+				buf.WriteString(", ")
+			}
+			buf.WriteString("?")
+			expanded = append(expanded, value.Index(j).Interface())
+		}
+	}
+	buf.WriteString(sql[last:])
+	return buf.String(), expanded
+}
+
+func isExpandable(arg interface{}) bool {
+	if arg == nil {
+		return false
+	}
+	if _, ok := arg.(driver.Valuer); ok {
+		return false
+	}
+	t := reflect.TypeOf(arg)
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		return t.Elem().Kind() != reflect.Uint8
+	}
+	return false
+}
+
+// offsets of '?' in sql, quoted strings/identifiers and comments are skipped
+func findPlaceholders(sql string) []int {
+	marks := make([]int, 0, 8)
+	for i := 0; i < len(sql); i++ {
+		switch c := sql[i]; c {
+		case '?':
+			marks = append(marks, i)
+		case '\'', '"', '`':
+			for i++; i < len(sql) && sql[i] != c; i++ {
+				if sql[i] == '\\' && c != '`' {
+					i++
+				}
+			}
+		case '-', '#', '/':
+			end := ""
+			if c == '#' || c == '-' && strings.HasPrefix(sql[i:], "-- ") {
+				end = "\n"
+			} else if c == '/' && strings.HasPrefix(sql[i:], "/*") {
+				end = "*/"
+			} else {
+				continue
+			}
+			j := strings.Index(sql[i:], end)
+			if j < 0 {
+				return marks
+			}
+			i += j + len(end) - 1
+		}
+	}
+	return marks
+}
+
+// check the type of statement classified by SqlTypeOf
 func CheckSqlType(sql string, t SqlType) error {
-	// remove the leading tab, leading spaces are trimed already
-	sql = strings.TrimLeft(sql, "\t")
-	// check the first 10 bytes
-	begin := strings.ToUpper(string([]byte(sql)[0:10]))
-	if strings.HasPrefix(begin, t.String()) {
+	if SqlTypeOf(sql) == t {
 		return nil
 	} else {
-		return errors.New(fmt.Sprintf("[%s] is not %s statement", sql, t.String()))
+		return errors.New(fmt.Sprintf("[%s] is not %s statement", strings.TrimSpace(sql), t.String()))
+	}
+}
+
+// type of statement by the leading keyword, spaces, comments and parentheses are skipped:
+//
+//	(SELECT ...) UNION (SELECT ...)      SELECT
+//	WITH t AS (SELECT ...) DELETE ...    DELETE, classified by the statement after common table expressions
+//	REPLACE INTO ..., INSERT IGNORE ...  INSERT
+//	INSERT INTO ... SELECT ...           INSERT
+//
+// SQL_TYPE_BEGIN is returned if the type is not supported
+func SqlTypeOf(sql string) SqlType {
+	lx := sqlLexer{sql: sql}
+	word, depth := lx.next()
+	switch keyword := strings.ToUpper(word); keyword {
+	case "WITH":
+		// the first statement keyword out of parentheses of common table expressions
+		for {
+			word, d := lx.next()
+			if word == "" || d < depth {
+				return SQL_TYPE_BEGIN
+			}
+			if t := keywordType(strings.ToUpper(word)); d == depth && t != SQL_TYPE_BEGIN {
+				return t
+			}
+		}
+	default:
+		return keywordType(keyword)
+	}
+}
+
+func keywordType(keyword string) SqlType {
+	switch keyword {
+	case "SELECT":
+		return SQL_SELECT
+	case "INSERT", "REPLACE":
+		return SQL_INSERT
+	case "UPDATE":
+		return SQL_UPDATE
+	case "DELETE":
+		return SQL_DELETE
+	default:
+		return SQL_TYPE_BEGIN
 	}
 }
 
+// words of sql, quoted strings/identifiers, comments and variables "#{Name}" are skipped
+type sqlLexer struct {
+	sql   string
+	pos   int
+	depth int // depth of parentheses
+}
+
+// next word and depth of parentheses, empty word at the end of sql
+func (lx *sqlLexer) next() (string, int) {
+	sql := lx.sql
+	for lx.pos < len(sql) {
+		c := sql[lx.pos]
+		switch {
+		case c == '(':
+			lx.depth++
+		case c == ')':
+			lx.depth--
+		case c == '#' && strings.HasPrefix(sql[lx.pos:], "#{"):
+			// variable "#{Name}" is not comment
+			lx.skipTo("}")
+			continue
+		case c == '#' || c == '-' && strings.HasPrefix(sql[lx.pos:], "--") && (lx.pos+2 == len(sql) || sql[lx.pos+2] <= ' '):
+			lx.skipTo("\n")
+			continue
+		case c == '/' && strings.HasPrefix(sql[lx.pos:], "/*"):
+			lx.pos += 2
+			lx.skipTo("*/")
+			continue
+		case c == '\'' || c == '"' || c == '`':
+			for lx.pos++; lx.pos < len(sql) && sql[lx.pos] != c; lx.pos++ {
+				if sql[lx.pos] == '\\' && c != '`' {
+					lx.pos++
+				}
+			}
+		case isWordChar(c):
+			start := lx.pos
+			for lx.pos < len(sql) && isWordChar(sql[lx.pos]) {
+				lx.pos++
+			}
+			return sql[start:lx.pos], lx.depth
+		}
+		lx.pos++
+	}
+	return "", lx.depth
+}
+
+// move to the end of next s, or the end of sql
+func (lx *sqlLexer) skipTo(s string) {
+	if i := strings.Index(lx.sql[lx.pos:], s); i >= 0 {
+		lx.pos += i + len(s)
+	} else {
+		lx.pos = len(lx.sql)
+	}
+}
+
+func isWordChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '$' || c >= 0x80
+}
+
 // find all variables defined as '#{Name}' with '?' in sql statement
 // replace the variable names with '?'
 func FormatSqlAndVars(sql string) (string, []string, error) {
@@ -138,61 +504,167 @@ func FormatSqlAndVars(sql string) (string, []string, error) {
 			// repeat on the remaining string
 			s = string(bytes[j+1:])
 		} else {
-			return str, vars, errors.New(fmt.Sprintf("Unmatched '#{' and '}' in %s", sql))
+			off := len(sql) - len(s) + unmatchedBrace(s)
+			return str, vars, errors.New(fmt.Sprintf("Unmatched '#{' and '}' at offset %d near '%s'", off, snippet(sql[off:], 20)))
 		}
 	}
 	return str, vars, nil
 }
 
 func NewSqlMapByFile(xmlFilePath string) (*SqlMap, error) {
-	file, err := os.Open(xmlFilePath)
+	return NewSqlMapByFiles(xmlFilePath)
+}
+
+// statements of all files are merged into one SqlMap, error is returned if an id is defined twice
+// fragments and resultMaps of all files are added before statements, so they can be referred in any file
+func NewSqlMapByFiles(xmlFilePaths ...string) (*SqlMap, error) {
+	return loadFiles(xmlFilePaths, readFile)
+}
+
+func readFile(path string) ([]byte, error) {
+	file, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
 
-	xmlBytes, err := ioutil.ReadAll(file)
-	if err != nil {
+	return ioutil.ReadAll(file)
+}
+
+func NewSqlMap(xmlBytes []byte) (*SqlMap, error) {
+	var mapper SqlMap
+	mapper.InitMap()
+
+	if err := mapper.Load(xmlBytes); err != nil {
 		return nil, err
 	}
+	return &mapper, nil
+}
 
-	return NewSqlMap(xmlBytes)
+// parse statements of a <sqlmap> and add them to sm, ids are qualified by attribute namespace of <sqlmap>:
+//
+//	<sqlmap namespace="user">
+//		<select id="selectAll">...</select>    <!-- referred as "user.selectAll" -->
+//	</sqlmap>
+//
+// Fragments and resultMaps of the same namespace are referred without namespace, others by qualified ids.
+// Error is returned if an id is already defined, sm should not be used after error.
+// All problems of the xml are reported as SqlMapErrors, see errors.go.
+func (sm *SqlMap) Load(xmlBytes []byte) error {
+	return sm.load("", xmlBytes)
 }
 
-func NewSqlMap(xmlBytes []byte) (*SqlMap, error) {
+// file is the name reported in errors, empty if not loaded from file
+func (sm *SqlMap) load(file string, xmlBytes []byte) error {
+	f := parseSqlFile(file, xmlBytes)
+	sm.loadDefinitions(f)
+	sm.loadStatements(f)
+	if len(f.errs) > 0 {
+		return f.errs
+	}
+	return nil
+}
+
+// sqlmap xml being loaded, problems are collected in errs
+type sqlFile struct {
+	name      string // reported in errors, empty if not loaded from file
+	xmlBytes  []byte
+	sqls      *XmlSqls // nil if xml is invalid
+	positions map[string][]xmlPosition
+	failed    map[int]bool // fragments not added
+	errs      SqlMapErrors
+}
+
+// parse xml and locate its elements, syntax error is reported in errs of the file
+func parseSqlFile(name string, xmlBytes []byte) *sqlFile {
+	f := &sqlFile{name: name, xmlBytes: xmlBytes, failed: make(map[int]bool)}
 	var sqls XmlSqls
-	err := xml.Unmarshal(xmlBytes, &sqls)
+	if err := xml.Unmarshal(xmlBytes, &sqls); err != nil {
+		f.errs = SqlMapErrors{newSyntaxError(name, xmlBytes, err)}
+		return f
+	}
+	positions, err := elementPositions(xmlBytes)
 	if err != nil {
-		return nil, err
+		f.errs = SqlMapErrors{newSyntaxError(name, xmlBytes, err)}
+		return f
 	}
+	sqls.Namespace = strings.TrimSpace(sqls.Namespace)
+	f.sqls, f.positions = &sqls, positions
+	return f
+}
 
-	var mapper SqlMap
-	mapper.InitMap()
-
-	for _, v := range sqls.Selects {
-		err = mapper.Add(&v, SQL_SELECT)
-		if err != nil {
-			return nil, err
+// collect problem of the i-th element named name in xml, such as the second <select>
+func (f *sqlFile) report(name string, i int, id string, err error) {
+	e := &SqlMapError{File: f.name, Id: qualifyId(f.sqls.Namespace, strings.TrimSpace(id)), Reason: err.Error()}
+	if i < len(f.positions[name]) {
+		pos := f.positions[name][i]
+		e.Line, e.Column = lineColumn(f.xmlBytes, pos.start)
+		// unmatched brace of static statement
+		if inner := pos.inner; inner >= 0 && name != "resultMap" && !strings.Contains(string(f.xmlBytes[inner:pos.end]), "<") {
+			if off := unmatchedBrace(string(f.xmlBytes[inner:pos.end])); off >= 0 {
+				e.Line, e.Column = lineColumn(f.xmlBytes, inner+off)
+			}
 		}
 	}
-	for _, v := range sqls.Inserts {
-		err = mapper.Add(&v, SQL_INSERT)
-		if err != nil {
-			return nil, err
+	if strings.TrimSpace(id) == "" {
+		e.Id = ""
+	}
+	f.errs = append(f.errs, e)
+}
+
+// add fragments and resultMaps, which are referred by statements
+func (sm *SqlMap) loadDefinitions(f *sqlFile) {
+	if f.sqls == nil {
+		return
+	}
+	ns := f.sqls.Namespace
+	for i, v := range f.sqls.Fragments {
+		if err := sm.addFragment(ns, &v); err != nil {
+			f.report("sql", i, v.Id, err)
+			f.failed[i] = true
 		}
 	}
-	for _, v := range sqls.Updates {
-		err = mapper.Add(&v, SQL_UPDATE)
-		if err != nil {
-			return nil, err
+	for i, v := range f.sqls.ResultMaps {
+		if err := sm.addResultMap(ns, &v); err != nil {
+			f.report("resultMap", i, v.Id, err)
 		}
 	}
-	for _, v := range sqls.Deletes {
-		err = mapper.Add(&v, SQL_DELETE)
-		if err != nil {
-			return nil, err
+}
+
+// add statements, fragments and resultMaps they refer to must be added already
+func (sm *SqlMap) loadStatements(f *sqlFile) {
+	if f.sqls == nil {
+		return
+	}
+	ns := f.sqls.Namespace
+
+	// fragments not included by any statement are checked as well
+	fragments := sm.fragmentsOf(ns)
+	for i, v := range f.sqls.Fragments {
+		if f.failed[i] {
+			continue
+		}
+		id := strings.Trim(v.Id, " ")
+		p := &sqlParser{fragments: fragments, including: []string{id}}
+		if _, err := p.parse(v.Inner); err != nil {
+			f.report("sql", i, id, errors.New(fmt.Sprintf("invalid <sql> fragment '%s': %s", qualifyId(ns, id), err.Error())))
 		}
 	}
 
-	return &mapper, nil
+	for _, nodes := range []struct {
+		name  string
+		nodes []XmlSqlNode
+		t     SqlType
+	}{
+		{"select", f.sqls.Selects, SQL_SELECT},
+		{"insert", f.sqls.Inserts, SQL_INSERT},
+		{"update", f.sqls.Updates, SQL_UPDATE},
+		{"delete", f.sqls.Deletes, SQL_DELETE},
+	} {
+		for i, v := range nodes.nodes {
+			if err := sm.add(ns, &v, nodes.t); err != nil {
+				f.report(nodes.name, i, v.Id, err)
+			}
+		}
+	}
 }
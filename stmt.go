@@ -0,0 +1,221 @@
+package gomapper
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"sync"
+)
+
+type cachedStmt struct {
+	sql  string // statement text used to prepare stmt
+	stmt *sql.Stmt
+	refs int // the cache and running queries, stmt is closed when no one refers to it
+}
+
+// cache of prepared statements keyed by SqlElement.Id, shared by GoMapper and its transactions
+// statements are prepared lazily on *sql.DB and rebound to *sql.Tx by tx.Stmt
+// statements removed from cache are closed after the queries using them are finished
+type stmtCache struct {
+	mu     sync.Mutex
+	db     *sql.DB
+	stmts  map[string]*cachedStmt
+	closed bool // nothing is cached after closed, transactions begun before run statements unprepared
+}
+
+func newStmtCache(db *sql.DB) *stmtCache {
+	return &stmtCache{db: db, stmts: make(map[string]*cachedStmt)}
+}
+
+// get the prepared statement of element, prepare it on first use
+// the statement must be released after used, nil is returned if the cache is closed
+func (sc *stmtCache) get(ctx context.Context, element *SqlElement) (*cachedStmt, error) {
+	sc.mu.Lock()
+	if sc.closed {
+		sc.mu.Unlock()
+		return nil, nil
+	}
+	if cached, ok := sc.stmts[element.Id]; ok && cached.sql == element.Sql {
+		cached.refs++
+		sc.mu.Unlock()
+		return cached, nil
+	}
+	sc.mu.Unlock()
+
+	stmt, err := sc.db.PrepareContext(ctx, element.Sql)
+	if err != nil {
+		return nil, err
+	}
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if sc.closed {
+		stmt.Close()
+		return nil, nil
+	}
+	if cached, ok := sc.stmts[element.Id]; ok {
+		if cached.sql == element.Sql {
+			// prepared by another go routine in the meantime
+			stmt.Close()
+			cached.refs++
+			return cached, nil
+		}
+		// statement text of the id has been changed
+		sc.drop(element.Id, cached)
+	}
+	cached := &cachedStmt{sql: element.Sql, stmt: stmt, refs: 2}
+	sc.stmts[element.Id] = cached
+	return cached, nil
+}
+
+// release the statement returned by get
+func (sc *stmtCache) release(cached *cachedStmt) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.unref(cached)
+}
+
+func (sc *stmtCache) unref(cached *cachedStmt) error {
+	cached.refs--
+	if cached.refs == 0 {
+		return cached.stmt.Close()
+	}
+	return nil
+}
+
+// remove the statement from cache, it is closed when released by all queries, mu must be locked
+func (sc *stmtCache) drop(id string, cached *cachedStmt) error {
+	delete(sc.stmts, id)
+	return sc.unref(cached)
+}
+
+// remove statement from cache if the connection is broken, it will be prepared again on next use
+// nothing is done if the statement has been replaced already
+func (sc *stmtCache) evict(id string, cached *cachedStmt, err error) {
+	if !errors.Is(err, driver.ErrBadConn) {
+		return
+	}
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if sc.stmts[id] == cached {
+		sc.drop(id, cached)
+	}
+}
+
+// remove statements of ids not in sqlMap or changed, such as after sqlmap files are reloaded
+func (sc *stmtCache) sync(sqlMap *SqlMap) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	for id, cached := range sc.stmts {
+		if element, ok := sqlMap.Sqls[id]; !ok || element.Sql != cached.sql {
+			sc.drop(id, cached)
+		}
+	}
+}
+
+// remove the statement of id, used when the statement is removed from mapper
+func (sc *stmtCache) remove(id string) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if cached, ok := sc.stmts[id]; ok {
+		sc.drop(id, cached)
+	}
+}
+
+// close all prepared statements, statements in use are closed after released
+func (sc *stmtCache) close() error {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.closed = true
+	var err error
+	for id, cached := range sc.stmts {
+		if e := sc.drop(id, cached); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// find the prepared statement for element, stmt is nil if cache is disabled or closed,
+// or query is not the static text of element (dynamic sql is never cached)
+// cached is the statement saved in cache, stmt is rebound to the transaction if any
+func (m *Mapper) prepared(ctx context.Context, element *SqlElement, query string) (stmt *sql.Stmt, cached *cachedStmt, err error) {
+	if m.stmts == nil || query != element.Sql {
+		return nil, nil, nil
+	}
+	cached, err = m.stmts.get(ctx, element)
+	if cached == nil {
+		return nil, nil, err
+	}
+	// statements rebound by tx.Stmt are closed when the transaction ends
+	if tx, ok := m.DB.(*sql.Tx); ok {
+		return tx.StmtContext(ctx, cached.stmt), cached, nil
+	}
+	return cached.stmt, cached, nil
+}
+
+// ExecContext through prepared statement if cache is enabled
+func (m *Mapper) execContext(ctx context.Context, element *SqlElement, query string, args []interface{}) (sql.Result, error) {
+	stmts := m.stmts // the cache may be disabled before the statement is released
+	stmt, cached, err := m.prepared(ctx, element, query)
+	if err != nil {
+		return nil, err
+	}
+	if stmt == nil {
+		return m.DB.ExecContext(ctx, query, args...)
+	}
+	defer stmts.release(cached)
+
+	result, err := stmt.ExecContext(ctx, args...)
+	if err != nil {
+		stmts.evict(element.Id, cached, err)
+	}
+	return result, err
+}
+
+// QueryContext through prepared statement if cache is enabled,
+// release must be called when rows are closed
+func (m *Mapper) queryContext(ctx context.Context, element *SqlElement, query string, args []interface{}) (rows *sql.Rows, release func(), err error) {
+	release = func() {}
+	stmts := m.stmts // the cache may be disabled before rows are closed
+	stmt, cached, err := m.prepared(ctx, element, query)
+	if err != nil {
+		return nil, release, err
+	}
+	if stmt == nil {
+		rows, err = m.DB.QueryContext(ctx, query, args...)
+		return rows, release, err
+	}
+
+	rows, err = stmt.QueryContext(ctx, args...)
+	if err != nil {
+		stmts.evict(element.Id, cached, err)
+		stmts.release(cached)
+		return nil, release, err
+	}
+	return rows, func() { stmts.release(cached) }, nil
+}
+
+// enable or disable the prepared statement cache, disabled by default
+// must be called before the mapper is used by concurrent go routines
+func (gm *GoMapper) SetStmtCache(enabled bool) error {
+	if !enabled {
+		if gm.stmts == nil {
+			return nil
+		}
+		stmts := gm.stmts
+		gm.stmts = nil
+		return stmts.close()
+	}
+
+	if gm.stmts != nil {
+		return nil
+	}
+	db, ok := gm.DB.(*sql.DB)
+	if !ok || db == nil {
+		return errors.New("Invalid *sql.DB instance")
+	}
+	gm.stmts = newStmtCache(db)
+	return nil
+}
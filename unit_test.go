@@ -4,11 +4,21 @@
 package gomapper
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
 	_ "github.com/go-sql-driver/mysql"
+	"io"
 	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
 	"time"
 )
 
@@ -52,6 +62,123 @@ func GetMySQLConnection() (*sql.DB, error) {
 	return sql.Open("mysql", ds)
 }
 
+// in-memory driver used to test scanning without MySQL
+// every query returns the rows registered by SetFakeRows for the sql statement
+type fakeDriver struct{}
+type fakeConn struct{}
+type fakeStmt struct{ query string }
+type fakeTx struct{}
+
+type fakeRows struct {
+	columns []string
+	types   []string // database type names of columns
+	values  [][]driver.Value
+	pos     int
+}
+
+var fakeResults = make(map[string]*fakeRows)
+
+func init() {
+	sql.Register("fake", fakeDriver{})
+}
+
+func SetFakeRows(query string, columns, types []string, values ...[]driver.Value) {
+	fakeResults[query] = &fakeRows{columns: columns, types: types, values: values}
+}
+
+func GetFakeConnection() *sql.DB {
+	db, _ := sql.Open("fake", "")
+	return db
+}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) { return fakeConn{}, nil }
+func (fakeConn) Close() error                            { return nil }
+func (fakeConn) Begin() (driver.Tx, error)               { return fakeTx{}, nil }
+func (fakeTx) Commit() error                             { return nil }
+func (fakeTx) Rollback() error                           { return nil }
+func (fakeStmt) NumInput() int                           { return -1 }
+
+// prepared and closed statements, errors returned by Exec, keyed by query
+var fakeStmts = struct {
+	sync.Mutex
+	prepared   map[string]int
+	closed     map[string]int
+	execErrors map[string]error
+}{prepared: map[string]int{}, closed: map[string]int{}, execErrors: map[string]error{}}
+
+func SetFakeExecError(query string, err error) {
+	fakeStmts.Lock()
+	defer fakeStmts.Unlock()
+	fakeStmts.execErrors[query] = err
+}
+
+// numbers of prepared and closed statements of query
+func GetFakeStmtStats(query string) (int, int) {
+	fakeStmts.Lock()
+	defer fakeStmts.Unlock()
+	return fakeStmts.prepared[query], fakeStmts.closed[query]
+}
+
+// clear the numbers and errors of all statements, so tests can be run repeatedly
+func ResetFakeStmts() {
+	fakeStmts.Lock()
+	defer fakeStmts.Unlock()
+	fakeStmts.prepared = map[string]int{}
+	fakeStmts.closed = map[string]int{}
+	fakeStmts.execErrors = map[string]error{}
+}
+
+func (fakeConn) Prepare(query string) (driver.Stmt, error) {
+	fakeStmts.Lock()
+	defer fakeStmts.Unlock()
+	fakeStmts.prepared[query]++
+	return fakeStmt{query: query}, nil
+}
+
+func (st fakeStmt) Close() error {
+	fakeStmts.Lock()
+	defer fakeStmts.Unlock()
+	fakeStmts.closed[st.query]++
+	return nil
+}
+
+func (st fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	fakeStmts.Lock()
+	defer fakeStmts.Unlock()
+	if err := fakeStmts.execErrors[st.query]; err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (st fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	rows, ok := fakeResults[st.query]
+	if !ok {
+		return nil, fmt.Errorf("no rows registered for [%s]", st.query)
+	}
+	copied := *rows
+	return &copied, nil
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) ColumnTypeDatabaseTypeName(i int) string {
+	if i < len(r.types) {
+		return r.types[i]
+	}
+	return ""
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.values) {
+		return io.EOF
+	}
+	copy(dest, r.values[r.pos])
+	r.pos++
+	return nil
+}
+
 func TestFormatSqlAndVars(t *testing.T) {
 	fmt.Println("\n---------- TestFormatSqlAndVars ----------")
 	sql := "SELECT id, a, b, c FROM t WHERE id=#{Id} and d=#{Data}"
@@ -94,6 +221,298 @@ func TestParseQueryArgs(t *testing.T) {
 		t.Fatal()
 	}
 	fmt.Printf("Args1: %v\n", args1)
+
+	args2, err := ParseQueryArgs(names, map[string]interface{}{"Id": 100, "FirstName": "Lisa", "CreatedAt": record.CreatedAt, "EmailVerified": true})
+	if err != nil {
+		t.Fatal()
+	}
+	fmt.Printf("Args2: %v\n", args2)
+	if len(args2) != 4 || args2[0] != 100 || args2[1] != "Lisa" {
+		t.Fatal()
+	}
+
+	// missing key should fail
+	_, err = ParseQueryArgs(names, map[string]string{"Id": "100"})
+	if err == nil {
+		fmt.Printf("ParseQueryArgs should fail, but successed\n")
+		t.Fatal()
+	}
+	fmt.Printf("Expected failure! error msg: %s\n", err.Error())
+
+	// pointer, nested path and embedded struct
+	type Address struct {
+		City string
+	}
+	type Contact struct {
+		Email string
+	}
+	type User struct {
+		Record
+		*Contact
+		Address *Address
+		Tags    map[string]string
+	}
+	user := &User{Record: record, Address: &Address{City: "Beijing"}, Tags: map[string]string{"level": "vip"}}
+	args3, err := ParseQueryArgs([]string{"Id", "Address.City", "Tags.level", "Email"}, user)
+	if err != nil {
+		fmt.Println(err.Error())
+		t.Fatal()
+	}
+	fmt.Printf("Args3: %v\n", args3)
+	if args3[0] != int64(100) || args3[1] != "Beijing" || args3[2] != "vip" || args3[3] != nil {
+		t.Fatal()
+	}
+
+	// nil pointer in the middle of path is NULL
+	user.Address = nil
+	args4, err := ParseQueryArgs([]string{"Address.City"}, user)
+	if err != nil || args4[0] != nil {
+		t.Fatal()
+	}
+
+	// every variable of nil pointer to struct is NULL
+	args5, err := ParseQueryArgs([]string{"Id", "FirstName"}, (*Record)(nil))
+	if err != nil || !reflect.DeepEqual(args5, []interface{}{nil, nil}) {
+		fmt.Printf("unexpected args: %v, error: %v\n", args5, err)
+		t.Fatal()
+	}
+}
+
+func TestContext(t *testing.T) {
+	fmt.Println("\n---------- TestContext ----------")
+	SetFakeRows("select id from ctx", []string{"id"}, nil, []driver.Value{int64(1)})
+	mapper, err := NewGoMapper(GetFakeConnection(), []byte(`<sqlmap>
+	<select id="selectIds">select id from ctx</select>
+	<insert id="insertId">insert into ctx(id) values(#{Id})</insert>
+	<update id="updateId">update ctx set id=#{Id}</update>
+	<delete id="deleteId">delete from ctx where id=#{Id}</delete>
+</sqlmap>`))
+	if err != nil {
+		fmt.Println(err.Error())
+		t.Fatal()
+	}
+	defer mapper.Close()
+
+	type ctxKey struct{}
+	var logged []context.Context
+	mapper.SetContextLogger(func(ctx context.Context, format string, args ...interface{}) {
+		logged = append(logged, ctx)
+	})
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	arg := Record{Id: 1}
+	calls := func(m *Mapper, ctx context.Context) map[string]func() error {
+		return map[string]func() error{
+			"InsertContext": func() error { _, err := m.InsertContext(ctx, "insertId", arg); return err },
+			"UpdateContext": func() error { _, err := m.UpdateContext(ctx, "updateId", arg); return err },
+			"DeleteContext": func() error { _, err := m.DeleteContext(ctx, "deleteId", arg); return err },
+			"SelectContext": func() error {
+				rows, err := m.SelectContext(ctx, "selectIds")
+				if err == nil {
+					rows.Close()
+				}
+				return err
+			},
+			"GetContext":        func() error { var id int64; return m.GetContext(ctx, "selectIds").Scan(&id) },
+			"SelectListContext": func() error { var ids []int64; return m.SelectListContext(ctx, "selectIds", &ids) },
+			"SelectOneContext":  func() error { var id int64; return m.SelectOneContext(ctx, "selectIds", &id) },
+		}
+	}
+
+	for _, cache := range []bool{false, true} {
+		if err = mapper.SetStmtCache(cache); err != nil {
+			t.Fatal(err)
+		}
+		tx, err := mapper.BeginTx(context.Background(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for path, m := range map[string]*Mapper{"db": &mapper.Mapper, "tx": &tx.Mapper} {
+			// canceled context reaches database/sql
+			for name, call := range calls(m, canceled) {
+				if err = call(); !errors.Is(err, context.Canceled) {
+					fmt.Printf("%s of %s with stmt cache %v returns %v\n", name, path, cache, err)
+					t.Fatal()
+				}
+			}
+
+			// logger receives the context of caller
+			for name := range calls(m, nil) {
+				ctx := context.WithValue(context.Background(), ctxKey{}, name)
+				logged = nil
+				if err = calls(m, ctx)[name](); err != nil {
+					fmt.Printf("%s of %s: %s\n", name, path, err.Error())
+					t.Fatal()
+				}
+				if len(logged) != 1 || logged[0].Value(ctxKey{}) != name {
+					fmt.Printf("%s of %s logged %v\n", name, path, logged)
+					t.Fatal()
+				}
+			}
+		}
+		if err = tx.Rollback(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err = mapper.BeginTx(canceled, nil); !errors.Is(err, context.Canceled) {
+		fmt.Printf("BeginTx returns %v\n", err)
+		t.Fatal()
+	}
+}
+
+func TestStmtCache(t *testing.T) {
+	fmt.Println("\n---------- TestStmtCache ----------")
+	ResetFakeStmts()
+	insert, query := "insert into cached(first_name) values(?)", "select id from cached"
+	SetFakeRows(query, []string{"id"}, nil, []driver.Value{int64(1)}, []driver.Value{int64(2)})
+	mapper, err := NewGoMapper(GetFakeConnection(), []byte(`<sqlmap>
+	<insert id="insertName">insert into cached(first_name) values(#{FirstName})</insert>
+	<select id="selectIds">select id from cached</select>
+</sqlmap>`))
+	if err != nil {
+		fmt.Println(err.Error())
+		t.Fatal()
+	}
+	defer mapper.Close()
+	if err = mapper.SetStmtCache(true); err != nil {
+		t.Fatal(err)
+	}
+	arg := Record{FirstName: "x"}
+
+	// prepared lazily on first use, and reused later
+	if prepared, _ := GetFakeStmtStats(insert); prepared != 0 {
+		t.Fatal()
+	}
+	for i := 0; i < 3; i++ {
+		if _, err = mapper.Insert("insertName", arg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if prepared, closed := GetFakeStmtStats(insert); prepared != 1 || closed != 0 {
+		fmt.Printf("prepared: %d, closed: %d\n", prepared, closed)
+		t.Fatal()
+	}
+
+	// rebound to transaction, the cached statement is still usable after commit
+	tx, err := mapper.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tx.Insert("insertName", arg); err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = mapper.Insert("insertName", arg); err != nil {
+		t.Fatal(err)
+	}
+	if len(mapper.stmts.stmts) != 1 {
+		t.Fatal()
+	}
+
+	// errors of statement keep it in cache, broken connection evicts it
+	SetFakeExecError(insert, errors.New("Duplicate entry 'x' for key 'first_name'"))
+	if _, err = mapper.Insert("insertName", arg); err == nil {
+		t.Fatal()
+	}
+	fmt.Println("Expected failure! error msg:", err.Error())
+	if _, ok := mapper.stmts.stmts["insertName"]; !ok {
+		t.Fatal()
+	}
+	SetFakeExecError(insert, driver.ErrBadConn)
+	if _, err = mapper.Insert("insertName", arg); err == nil {
+		t.Fatal()
+	}
+	fmt.Println("Expected failure! error msg:", err.Error())
+	if _, ok := mapper.stmts.stmts["insertName"]; ok {
+		t.Fatal()
+	}
+	SetFakeExecError(insert, nil)
+	if _, err = mapper.Insert("insertName", arg); err != nil {
+		t.Fatal(err)
+	}
+
+	// statement replaced while rows are read is closed after rows are closed
+	rows, err := mapper.Select("selectIds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	replaced := "select id from cached_v2"
+	SetFakeRows(replaced, []string{"id"}, nil, []driver.Value{int64(3)})
+	if err = mapper.ReplaceSql(SQL_SELECT, "selectIds", replaced); err != nil {
+		t.Fatal(err)
+	}
+	var id int64
+	if err = mapper.Get("selectIds").Scan(&id); err != nil || id != 3 {
+		fmt.Printf("unexpected id: %d, error: %v\n", id, err)
+		t.Fatal()
+	}
+	if _, closed := GetFakeStmtStats(query); closed != 0 {
+		t.Fatal()
+	}
+	var ids []int64
+	for rows.Next() {
+		if err = rows.Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	if err = rows.Close(); err != nil || !reflect.DeepEqual(ids, []int64{1, 2}) {
+		fmt.Printf("unexpected ids: %v, error: %v\n", ids, err)
+		t.Fatal()
+	}
+	if _, closed := GetFakeStmtStats(query); closed != 1 {
+		t.Fatal()
+	}
+
+	// statements in use are closed after rows are closed when cache is disabled
+	tx, err = mapper.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows, err = mapper.Select("selectIds"); err != nil {
+		t.Fatal(err)
+	}
+	if err = mapper.SetStmtCache(false); err != nil {
+		t.Fatal(err)
+	}
+	if _, closed := GetFakeStmtStats(replaced); closed != 0 {
+		t.Fatal()
+	}
+	ids = nil
+	for rows.Next() {
+		if err = rows.Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	if err = rows.Close(); err != nil || !reflect.DeepEqual(ids, []int64{3}) {
+		fmt.Printf("unexpected ids: %v, error: %v\n", ids, err)
+		t.Fatal()
+	}
+	if prepared, closed := GetFakeStmtStats(replaced); prepared != 1 || closed != 1 {
+		fmt.Printf("prepared: %d, closed: %d\n", prepared, closed)
+		t.Fatal()
+	}
+
+	// transactions begun before the cache is disabled run statements unprepared
+	if _, err = tx.Insert("insertName", arg); err != nil {
+		t.Fatal(err)
+	}
+	if len(tx.stmts.stmts) != 0 {
+		t.Fatal()
+	}
+	if err = tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	prepared, closed := GetFakeStmtStats(insert)
+	if prepared == 0 || prepared != closed {
+		fmt.Printf("prepared: %d, closed: %d\n", prepared, closed)
+		t.Fatal()
+	}
 }
 
 func TestSelectDmlTx(t *testing.T) {
@@ -388,3 +807,1772 @@ func TestSelectDmlTx(t *testing.T) {
 	}
 	fmt.Printf("There are %d records after commit, should be 1\n", cnt)
 }
+
+func TestDynamicSql(t *testing.T) {
+	fmt.Println("\n---------- TestDynamicSql ----------")
+	xmlDynamic := `
+<sqlmap>
+    <select id="selectByFilter">
+        SELECT id, first_name FROM t
+        <where>
+            <if test="FirstName != ''">AND first_name=#{FirstName}</if>
+            <if test="Id gt 0 and not EmailVerified">AND id=#{Id}</if>
+        </where>
+        <choose>
+            <when test="LastName == 'asc'">ORDER BY id ASC</when>
+            <otherwise>ORDER BY id DESC</otherwise>
+        </choose>
+    </select>
+    <update id="updateSelective">
+        UPDATE t
+        <set>
+            <if test="FirstName">first_name=#{FirstName},</if>
+            <if test="LastName">last_name=#{LastName},</if>
+        </set>
+        WHERE id=#{Id}
+    </update>
+</sqlmap>`
+
+	sqlMap, err := NewSqlMap([]byte(xmlDynamic))
+	if err != nil {
+		fmt.Println(err.Error())
+		t.Fatal()
+	}
+
+	cases := []struct {
+		id   string
+		arg  interface{}
+		sql  string
+		args int
+	}{
+		{"selectByFilter", Record{}, "SELECT id, first_name FROM t  ORDER BY id DESC", 0},
+		{"selectByFilter", Record{FirstName: "Lisa", Id: 1}, "SELECT id, first_name FROM t  WHERE first_name=? AND id=?  ORDER BY id DESC", 2},
+		{"selectByFilter", map[string]interface{}{"FirstName": "", "Id": 1, "EmailVerified": false, "LastName": "asc"},
+			"SELECT id, first_name FROM t  WHERE id=?  ORDER BY id ASC", 1},
+		{"updateSelective", &Record{Id: 1, LastName: "LL"}, "UPDATE t  SET last_name=?  WHERE id=?", 2},
+	}
+	for _, c := range cases {
+		element, err := sqlMap.Get(c.id)
+		if err != nil {
+			fmt.Println(err.Error())
+			t.Fatal()
+		}
+		sql, args, err := element.bind([]interface{}{c.arg}, SnakeCaseNaming, nil)
+		if err != nil {
+			fmt.Println(err.Error())
+			t.Fatal()
+		}
+		fmt.Printf("rendered sql: %s, args: %v\n", sql, args)
+		if sql != c.sql || len(args) != c.args {
+			fmt.Printf("expected: %s with %d args\n", c.sql, c.args)
+			t.Fatal()
+		}
+	}
+
+	// missing keys of map are nil in expressions, and errors if rendered as variables
+	optional, err := NewSqlMap([]byte(`<sqlmap>
+	<select id="selectOptional">SELECT id FROM t <where><if test="Age != nil">AND age=#{Age}</if><if test="Name != nil">AND name=#{Name}</if></where></select>
+	<select id="selectAge">SELECT id FROM t WHERE age=#{Age} <if test="Name != nil">AND name=#{Name}</if></select>
+</sqlmap>`))
+	if err != nil {
+		fmt.Println(err.Error())
+		t.Fatal()
+	}
+	element, _ := optional.Get("selectOptional")
+	sql, args, err := element.bind([]interface{}{map[string]interface{}{"Name": "x"}}, SnakeCaseNaming, nil)
+	fmt.Printf("rendered sql: %s, args: %v\n", sql, args)
+	if err != nil || strings.Join(strings.Fields(sql), " ") != "SELECT id FROM t WHERE name=?" || !reflect.DeepEqual(args, []interface{}{"x"}) {
+		fmt.Printf("unexpected error: %v\n", err)
+		t.Fatal()
+	}
+	element, _ = optional.Get("selectAge")
+	if _, _, err = element.bind([]interface{}{map[string]interface{}{"Name": "x"}}, SnakeCaseNaming, nil); err == nil {
+		t.Fatal()
+	}
+	fmt.Printf("Expected failure! error msg: %s\n", err.Error())
+
+	// invalid expression is reported by NewSqlMap
+	_, err = NewSqlMap([]byte(`<sqlmap><select id="s">SELECT id FROM t <if test="Id ==">AND 1</if></select></sqlmap>`))
+	if err == nil {
+		fmt.Println("invalid expression should fail")
+		t.Fatal()
+	}
+	fmt.Printf("Expected failure! error msg: %s\n", err.Error())
+}
+
+func TestForeachAndSliceArgs(t *testing.T) {
+	fmt.Println("\n---------- TestForeachAndSliceArgs ----------")
+	xmlForeach := `
+<sqlmap>
+    <select id="selectByIds">
+        SELECT id, first_name FROM t WHERE id IN
+        <foreach collection="Ids" item="id" open="(" separator="," close=")">#{id}</foreach>
+    </select>
+    <insert id="insertBatch">
+        INSERT INTO t(first_name, last_name) VALUES
+        <foreach collection="list" item="r" separator=",">(#{r.FirstName}, #{r.LastName})</foreach>
+    </insert>
+    <select id="selectInIds">
+        SELECT id, first_name FROM t WHERE first_name='?' AND id IN (#{Ids})
+    </select>
+</sqlmap>`
+
+	sqlMap, err := NewSqlMap([]byte(xmlForeach))
+	if err != nil {
+		fmt.Println(err.Error())
+		t.Fatal()
+	}
+
+	cases := []struct {
+		id   string
+		arg  interface{}
+		sql  string
+		args int
+	}{
+		{"selectByIds", map[string]interface{}{"Ids": []int64{1, 2, 3}}, "SELECT id, first_name FROM t WHERE id IN (?,?,?)", 3},
+		{"insertBatch", []Record{{FirstName: "Lilei"}, {FirstName: "David"}}, "INSERT INTO t(first_name, last_name) VALUES (?, ?),(?, ?)", 4},
+		{"selectInIds", struct{ Ids []int64 }{[]int64{1, 2}}, "SELECT id, first_name FROM t WHERE first_name='?' AND id IN (?, ?)", 2},
+		{"selectInIds", struct{ Ids []int64 }{[]int64{}}, "SELECT id, first_name FROM t WHERE first_name='?' AND id IN (NULL)", 0},
+	}
+	for _, c := range cases {
+		element, err := sqlMap.Get(c.id)
+		if err != nil {
+			fmt.Println(err.Error())
+			t.Fatal()
+		}
+		sql, args, err := element.bind([]interface{}{c.arg}, SnakeCaseNaming, nil)
+		if err != nil {
+			fmt.Println(err.Error())
+			t.Fatal()
+		}
+		fmt.Printf("rendered sql: %s, args: %v\n", sql, args)
+		if sql != c.sql || len(args) != c.args {
+			fmt.Printf("expected: %s with %d args\n", c.sql, c.args)
+			t.Fatal()
+		}
+	}
+
+	// positional slice argument
+	sql, args := ExpandSliceArgs("SELECT * FROM t WHERE id IN (?) AND email_verified=?", []interface{}{[]int{1, 2}, true})
+	fmt.Printf("expanded sql: %s, args: %v\n", sql, args)
+	if sql != "SELECT * FROM t WHERE id IN (?, ?) AND email_verified=?" || len(args) != 3 {
+		t.Fatal()
+	}
+}
+
+func TestSqlInclude(t *testing.T) {
+	fmt.Println("\n---------- TestSqlInclude ----------")
+	xmlInclude := `
+<sqlmap>
+    <sql id="columns">id, first_name, last_name</sql>
+    <sql id="byId">WHERE id=#{Id}</sql>
+    <sql id="selectById">SELECT <include refid="columns"/> FROM t <include refid="byId"/></sql>
+    <select id="selectNames">
+        <include refid="selectById"/>
+    </select>
+    <select id="selectByName">
+        SELECT <include refid="columns"/> FROM t
+        <where><if test="FirstName != ''">first_name=#{FirstName}</if></where>
+    </select>
+</sqlmap>`
+
+	sqlMap, err := NewSqlMap([]byte(xmlInclude))
+	if err != nil {
+		fmt.Println(err.Error())
+		t.Fatal()
+	}
+	element, err := sqlMap.Get("selectNames")
+	if err != nil {
+		fmt.Println(err.Error())
+		t.Fatal()
+	}
+	fmt.Printf("included sql: %s, vars: %v\n", element.Sql, element.Vars)
+	if element.Sql != "SELECT id, first_name, last_name FROM t WHERE id=?" || element.IsDynamic() {
+		t.Fatal()
+	}
+	element, err = sqlMap.Get("selectByName")
+	if err != nil || !element.IsDynamic() {
+		t.Fatal()
+	}
+
+	// unknown refid and circular include should fail
+	for _, x := range []string{
+		`<sqlmap><select id="s">SELECT <include refid="nothing"/> FROM t</select></sqlmap>`,
+		`<sqlmap><sql id="a"><include refid="b"/></sql><sql id="b"><include refid="a"/></sql></sqlmap>`,
+	} {
+		_, err = NewSqlMap([]byte(x))
+		if err == nil {
+			fmt.Printf("%s should fail\n", x)
+			t.Fatal()
+		}
+		fmt.Printf("Expected failure! error msg: %s\n", err.Error())
+	}
+}
+
+func TestStructTag(t *testing.T) {
+	fmt.Println("\n---------- TestStructTag ----------")
+	type Base struct {
+		Id        int64
+		CreatedAt time.Time
+	}
+	type TaggedRecord struct {
+		Base
+		UserID int64  `db:"user_id"`
+		Email  string `db:"email_addr"`
+		Cache  string `db:"-"`
+		Name   string
+	}
+	typ := reflect.TypeOf(TaggedRecord{})
+
+	columns := map[string]string{
+		"id":         "Id",
+		"created_at": "CreatedAt",
+		"user_id":    "UserID",
+		"email_addr": "Email",
+		"name":       "Name",
+	}
+	for column, name := range columns {
+		f, ok := fieldByColumn(typ, column, SnakeCaseNaming)
+		if !ok || f.name != name {
+			fmt.Printf("column %s should be mapped to %s\n", column, name)
+			t.Fatal()
+		}
+	}
+	for _, column := range []string{"cache", "email"} {
+		if f, ok := fieldByColumn(typ, column, SnakeCaseNaming); ok {
+			fmt.Printf("column %s should not be mapped, but mapped to %s\n", column, f.name)
+			t.Fatal()
+		}
+	}
+
+	record := TaggedRecord{Base: Base{Id: 1}, UserID: 2, Email: "a@b.c"}
+	args, err := ParseQueryArgs([]string{"user_id", "email_addr", "Email", "Id"}, record)
+	if err != nil {
+		fmt.Println(err.Error())
+		t.Fatal()
+	}
+	fmt.Printf("Args: %v\n", args)
+	if args[0] != int64(2) || args[1] != "a@b.c" || args[2] != "a@b.c" || args[3] != int64(1) {
+		t.Fatal()
+	}
+	if _, err = ParseQueryArgs([]string{"Cache"}, record); err == nil {
+		fmt.Println("field ignored by tag should not be found")
+		t.Fatal()
+	}
+}
+
+func TestNamingStrategy(t *testing.T) {
+	fmt.Println("\n---------- TestNamingStrategy ----------")
+	type Site struct {
+		UserID  int64
+		HomeURL string
+		Name    string
+	}
+	typ := reflect.TypeOf(Site{})
+
+	cases := []struct {
+		naming NamingStrategy
+		column string
+		field  string // empty if not mapped
+	}{
+		{SnakeCaseNaming, "name", "Name"},
+		{SnakeCaseNaming, "user_id", ""},
+		{InitialismNaming, "user_id", "UserID"},
+		{InitialismNaming, "home_url", "HomeURL"},
+		{ExactNaming, "UserID", "UserID"},
+		{ExactNaming, "name", ""},
+		{CaseInsensitiveNaming, "userid", "UserID"},
+		{CaseInsensitiveNaming, "HOMEURL", "HomeURL"},
+	}
+	for _, c := range cases {
+		f, ok := fieldByColumn(typ, c.column, c.naming)
+		if ok != (c.field != "") || f.name != c.field {
+			fmt.Printf("column %s should be mapped to '%s', got '%s'\n", c.column, c.field, f.name)
+			t.Fatal()
+		}
+	}
+
+	if s := SnakeToGoCamel("api_key_id"); s != "APIKeyID" {
+		fmt.Printf("SnakeToGoCamel: %s\n", s)
+		t.Fatal()
+	}
+
+	args, err := parseQueryArgs(InitialismNaming, []string{"user_id", "HomeURL"}, Site{UserID: 1, HomeURL: "http://a.b"})
+	if err != nil {
+		fmt.Println(err.Error())
+		t.Fatal()
+	}
+	fmt.Printf("Args: %v\n", args)
+	if args[0] != int64(1) || args[1] != "http://a.b" {
+		t.Fatal()
+	}
+}
+
+const fakeSelectAll = "select id, first_name, last_name, email_verified, created_at from t"
+
+func setFakeRecords(n int) {
+	values := make([][]driver.Value, n)
+	for i := range values {
+		values[i] = []driver.Value{int64(i + 1), "Lilei", "LL", true, time.Now()}
+	}
+	SetFakeRows(fakeSelectAll, []string{"id", "first_name", "last_name", "email_verified", "created_at"}, nil, values...)
+}
+
+func TestScanToStruct(t *testing.T) {
+	fmt.Println("\n---------- TestScanToStruct ----------")
+	setFakeRecords(3)
+	mapper, err := NewGoMapper(GetFakeConnection(), []byte(xmlsqls))
+	if err != nil {
+		fmt.Println(err.Error())
+		t.Fatal()
+	}
+	defer mapper.Close()
+
+	rows, err := mapper.Select("selectAll")
+	if err != nil {
+		fmt.Println(err.Error())
+		t.Fatal()
+	}
+	cnt := 0
+	for rows.Next() {
+		var rec Record
+		err = rows.Scan(&rec)
+		if err != nil {
+			fmt.Println(err.Error())
+			t.Fatal()
+		}
+		cnt++
+		if rec.Id != int64(cnt) || rec.FirstName != "Lilei" || !rec.EmailVerified {
+			fmt.Printf("unexpected record: %v\n", rec)
+			t.Fatal()
+		}
+	}
+	rows.Close()
+	if cnt != 3 {
+		t.Fatal()
+	}
+
+	// the plan is cached for struct type and columns
+	columns := []string{"id", "first_name", "last_name", "email_verified", "created_at"}
+	plan1, err := defaultScanPlans.get(reflect.TypeOf(Record{}), columns, scanOptions{policy: COLUMN_STRICT})
+	if err != nil {
+		t.Fatal()
+	}
+	plan2, _ := defaultScanPlans.get(reflect.TypeOf(Record{}), columns, scanOptions{policy: COLUMN_STRICT})
+	if plan1 != plan2 || len(plan1.fields) != len(columns) {
+		t.Fatal()
+	}
+}
+
+func TestColumnPolicy(t *testing.T) {
+	fmt.Println("\n---------- TestColumnPolicy ----------")
+	setFakeRecords(1)
+	xml := `<?xml version="1.0" encoding="utf-8"?>
+<sqlmap>
+	<select id="selectStrict">select id, first_name, last_name, email_verified, created_at from t</select>
+	<select id="selectIgnore" unknownColumns="ignore">select id, first_name, last_name, email_verified, created_at from t</select>
+	<select id="selectCollect" unknownColumns="collect">select id, first_name, last_name, email_verified, created_at from t</select>
+</sqlmap>`
+	mapper, err := NewGoMapper(GetFakeConnection(), []byte(xml))
+	if err != nil {
+		fmt.Println(err.Error())
+		t.Fatal()
+	}
+	defer mapper.Close()
+
+	type Partial struct {
+		Id        int64
+		FirstName string
+	}
+	type Collected struct {
+		Id     int64
+		Others map[string]interface{} `db:"*"`
+	}
+
+	// strict by default, error names column and struct type
+	var p Partial
+	err = mapper.Get("selectStrict").Scan(&p)
+	if err == nil || !strings.Contains(err.Error(), "last_name") || !strings.Contains(err.Error(), "Partial") {
+		fmt.Printf("unexpected error: %v\n", err)
+		t.Fatal()
+	}
+	fmt.Println("Expected failure! error msg:", err.Error())
+
+	// ignored by statement
+	p = Partial{}
+	if err = mapper.Get("selectIgnore").Scan(&p); err != nil || p.Id != 1 || p.FirstName != "Lilei" {
+		fmt.Printf("unexpected record: %v, error: %v\n", p, err)
+		t.Fatal()
+	}
+
+	// ignored by mapper
+	mapper.SetColumnPolicy(COLUMN_IGNORE)
+	rows, err := mapper.Select("selectStrict")
+	if err != nil {
+		fmt.Println(err.Error())
+		t.Fatal()
+	}
+	for rows.Next() {
+		p = Partial{}
+		if err = rows.Scan(&p); err != nil || p.Id != 1 {
+			fmt.Printf("unexpected record: %v, error: %v\n", p, err)
+			t.Fatal()
+		}
+	}
+	rows.Close()
+	mapper.SetColumnPolicy(COLUMN_POLICY_DEFAULT)
+
+	// collected into the map tagged by "*"
+	var c Collected
+	if err = mapper.Get("selectCollect").Scan(&c); err != nil {
+		fmt.Println(err.Error())
+		t.Fatal()
+	}
+	fmt.Printf("Collected: %v\n", c.Others)
+	if c.Id != 1 || len(c.Others) != 4 || c.Others["first_name"] != "Lilei" || c.Others["email_verified"] != true {
+		t.Fatal()
+	}
+
+	// no field to collect columns
+	if err = mapper.Get("selectCollect").Scan(&p); err == nil {
+		t.Fatal()
+	}
+	fmt.Println("Expected failure! error msg:", err.Error())
+
+	if _, err = NewGoMapper(GetFakeConnection(), []byte(`<sqlmap><select id="s" unknownColumns="skip">select * from t</select></sqlmap>`)); err == nil {
+		t.Fatal()
+	}
+	fmt.Println("Expected failure! error msg:", err.Error())
+}
+
+func TestScanToMap(t *testing.T) {
+	fmt.Println("\n---------- TestScanToMap ----------")
+	xml := `<?xml version="1.0" encoding="utf-8"?>
+<sqlmap>
+	<select id="report">select name, cnt, ratio, avatar, updated_at from report</select>
+</sqlmap>`
+	now := time.Now()
+	SetFakeRows("select name, cnt, ratio, avatar, updated_at from report",
+		[]string{"name", "cnt", "ratio", "avatar", "updated_at"},
+		[]string{"VARCHAR", "BIGINT", "DOUBLE", "BLOB", "DATETIME"},
+		[]driver.Value{[]byte("Lilei"), []byte("42"), []byte("0.5"), []byte{1, 2}, now},
+		[]driver.Value{[]byte("Hanmeimei"), nil, []byte("1.5"), nil, []byte("2026-10-17 00:00:00")})
+	mapper, err := NewGoMapper(GetFakeConnection(), []byte(xml))
+	if err != nil {
+		fmt.Println(err.Error())
+		t.Fatal()
+	}
+	defer mapper.Close()
+
+	var m map[string]interface{}
+	if err = mapper.Get("report").Scan(&m); err != nil {
+		fmt.Println(err.Error())
+		t.Fatal()
+	}
+	fmt.Printf("Map: %v\n", m)
+	if m["name"] != "Lilei" || m["cnt"] != int64(42) || m["ratio"] != 0.5 || !reflect.DeepEqual(m["avatar"], []byte{1, 2}) {
+		t.Fatal()
+	}
+	if tm, ok := m["updated_at"].(time.Time); !ok || !tm.Equal(now) {
+		t.Fatal()
+	}
+
+	rows, err := mapper.Select("report")
+	if err != nil {
+		fmt.Println(err.Error())
+		t.Fatal()
+	}
+	var all []map[string]string
+	for rows.Next() {
+		var s map[string]string
+		if err = rows.Scan(&s); err != nil {
+			fmt.Println(err.Error())
+			t.Fatal()
+		}
+		all = append(all, s)
+	}
+	rows.Close()
+	fmt.Printf("Maps: %v\n", all)
+	if len(all) != 2 || all[0]["cnt"] != "42" || all[1]["cnt"] != "" || all[1]["updated_at"] != "2026-10-17 00:00:00" {
+		t.Fatal()
+	}
+
+	var wrong map[string]int
+	if err = mapper.Get("report").Scan(&wrong); err == nil {
+		t.Fatal()
+	}
+	fmt.Println("Expected failure! error msg:", err.Error())
+}
+
+func TestSelectList(t *testing.T) {
+	fmt.Println("\n---------- TestSelectList ----------")
+	setFakeRecords(3)
+	SetFakeRows("select id from t", []string{"id"}, nil, []driver.Value{int64(1)}, []driver.Value{int64(2)})
+	SetFakeRows("select id from t where 1=0", []string{"id"}, nil)
+	xml := `<?xml version="1.0" encoding="utf-8"?>
+<sqlmap>
+	<select id="selectAll">select id, first_name, last_name, email_verified, created_at from t</select>
+	<select id="selectIds">select id from t</select>
+	<select id="selectNone">select id from t where 1=0</select>
+</sqlmap>`
+	mapper, err := NewGoMapper(GetFakeConnection(), []byte(xml))
+	if err != nil {
+		fmt.Println(err.Error())
+		t.Fatal()
+	}
+	defer mapper.Close()
+
+	var records []Record
+	if err = mapper.SelectList("selectAll", &records); err != nil || len(records) != 3 || records[2].Id != 3 {
+		fmt.Printf("unexpected records: %v, error: %v\n", records, err)
+		t.Fatal()
+	}
+	var pointers []*Record
+	if err = mapper.SelectList("selectAll", &pointers); err != nil || len(pointers) != 3 || pointers[0].FirstName != "Lilei" {
+		fmt.Printf("unexpected records: %v, error: %v\n", pointers, err)
+		t.Fatal()
+	}
+	var maps []map[string]interface{}
+	if err = mapper.SelectList("selectAll", &maps); err != nil || len(maps) != 3 || maps[1]["id"] != int64(2) {
+		fmt.Printf("unexpected records: %v, error: %v\n", maps, err)
+		t.Fatal()
+	}
+	var times []time.Time
+	if err = mapper.SelectListContext(context.Background(), "selectIds", &times); err == nil {
+		t.Fatal()
+	}
+	fmt.Println("Expected failure! error msg:", err.Error())
+	ids := []int64{100}
+	if err = mapper.SelectList("selectIds", &ids); err != nil || len(ids) != 2 || ids[0] != 1 || ids[1] != 2 {
+		fmt.Printf("unexpected ids: %v, error: %v\n", ids, err)
+		t.Fatal()
+	}
+	if err = mapper.SelectList("selectNone", &ids); err != nil || len(ids) != 0 {
+		t.Fatal()
+	}
+	if err = mapper.SelectList("selectIds", ids); err == nil {
+		t.Fatal()
+	}
+	fmt.Println("Expected failure! error msg:", err.Error())
+
+	var rec Record
+	if err = mapper.SelectOne("selectAll", &rec); err == nil {
+		t.Fatal()
+	}
+	fmt.Println("Expected failure! error msg:", err.Error())
+	var id int64
+	if err = mapper.SelectOne("selectNone", &id); err != sql.ErrNoRows {
+		t.Fatal()
+	}
+	setFakeRecords(1)
+	if err = mapper.SelectOneContext(context.Background(), "selectAll", &rec); err != nil || rec.Id != 1 {
+		fmt.Printf("unexpected record: %v, error: %v\n", rec, err)
+		t.Fatal()
+	}
+}
+
+func TestGenericQuery(t *testing.T) {
+	fmt.Println("\n---------- TestGenericQuery ----------")
+	setFakeRecords(3)
+	SetFakeRows("select id from t", []string{"id"}, nil, []driver.Value{int64(1)}, []driver.Value{int64(2)})
+	xml := `<?xml version="1.0" encoding="utf-8"?>
+<sqlmap>
+	<select id="selectAll">select id, first_name, last_name, email_verified, created_at from t</select>
+	<select id="selectIds">select id from t</select>
+</sqlmap>`
+	mapper, err := NewGoMapper(GetFakeConnection(), []byte(xml))
+	if err != nil {
+		fmt.Println(err.Error())
+		t.Fatal()
+	}
+	defer mapper.Close()
+
+	records, err := List[*Record](mapper, "selectAll")
+	if err != nil || len(records) != 3 || records[2].Id != 3 {
+		fmt.Printf("unexpected records: %v, error: %v\n", records, err)
+		t.Fatal()
+	}
+	ids, err := List[int64](mapper, "selectIds")
+	if err != nil || len(ids) != 2 || ids[1] != 2 {
+		fmt.Printf("unexpected ids: %v, error: %v\n", ids, err)
+		t.Fatal()
+	}
+
+	if _, err = One[Record](mapper, "selectAll"); err == nil {
+		t.Fatal()
+	}
+	fmt.Println("Expected failure! error msg:", err.Error())
+
+	cnt := 0
+	for rec, err := range Iter[Record](mapper, "selectAll") {
+		if err != nil {
+			fmt.Println(err.Error())
+			t.Fatal()
+		}
+		cnt++
+		if rec.Id != int64(cnt) {
+			t.Fatal()
+		}
+		if cnt == 2 {
+			break
+		}
+	}
+	for _, err := range Iter[Record](mapper, "selectNothing") {
+		if err == nil {
+			t.Fatal()
+		}
+		fmt.Println("Expected failure! error msg:", err.Error())
+	}
+
+	setFakeRecords(1)
+	m, err := One[map[string]interface{}](mapper, "selectAll")
+	if err != nil || m["first_name"] != "Lilei" {
+		fmt.Printf("unexpected record: %v, error: %v\n", m, err)
+		t.Fatal()
+	}
+}
+
+func TestResultMap(t *testing.T) {
+	fmt.Println("\n---------- TestResultMap ----------")
+	type Address struct {
+		City string
+	}
+	type Legacy struct {
+		Id        int64
+		FirstName string
+		Verified  bool
+		Address   *Address
+	}
+	SetFakeRows("select id, fname, verified_flag, city from t", []string{"ID", "fname", "verified_flag", "city"}, nil,
+		[]driver.Value{int64(1), "Lilei", true, "Beijing"})
+	xml := `<?xml version="1.0" encoding="utf-8"?>
+<sqlmap>
+	<select id="selectLegacy" resultMap="legacyMap">select id, fname, verified_flag, city from t</select>
+	<select id="selectWrongType" resultMap="recordMap">select id, fname, verified_flag, city from t</select>
+	<resultMap id="legacyMap" type="Legacy">
+		<id column="id" property="Id"/>
+		<result column="fname" property="FirstName"/>
+		<result column="verified_flag" property="Verified"/>
+		<result column="city" property="Address.City"/>
+	</resultMap>
+	<resultMap id="recordMap" type="Record">
+		<id column="id" property="Id"/>
+	</resultMap>
+</sqlmap>`
+	mapper, err := NewGoMapper(GetFakeConnection(), []byte(xml))
+	if err != nil {
+		fmt.Println(err.Error())
+		t.Fatal()
+	}
+	defer mapper.Close()
+
+	var rec Legacy
+	if err = mapper.Get("selectLegacy").Scan(&rec); err != nil {
+		fmt.Println(err.Error())
+		t.Fatal()
+	}
+	fmt.Printf("Record: %v, Address: %v\n", rec, rec.Address)
+	if rec.Id != 1 || rec.FirstName != "Lilei" || !rec.Verified || rec.Address == nil || rec.Address.City != "Beijing" {
+		t.Fatal()
+	}
+	if err = mapper.Get("selectWrongType").Scan(&rec); err == nil {
+		t.Fatal()
+	}
+	fmt.Println("Expected failure! error msg:", err.Error())
+
+	invalid := []string{
+		`<sqlmap><select id="s" resultMap="none">select * from t</select></sqlmap>`,
+		`<sqlmap><resultMap id="m"><result column="a" property="A"/><result column="A" property="B"/></resultMap></sqlmap>`,
+		`<sqlmap><resultMap id="m"><result column="a"/></resultMap></sqlmap>`,
+		`<sqlmap><resultMap id="m"/><resultMap id="m"/></sqlmap>`,
+		`<sqlmap><resultMap id="m"/><delete id="d" resultMap="m">delete from t</delete></sqlmap>`,
+	}
+	for _, x := range invalid {
+		if _, err = NewSqlMap([]byte(x)); err == nil {
+			fmt.Println(x)
+			t.Fatal()
+		}
+		fmt.Println("Expected failure! error msg:", err.Error())
+	}
+}
+
+func TestNestedResult(t *testing.T) {
+	fmt.Println("\n---------- TestNestedResult ----------")
+	type Address struct {
+		City string
+	}
+	type Order struct {
+		Id     int64
+		Amount float64
+	}
+	type User struct {
+		Id      int64
+		Name    string
+		Address *Address
+		Orders  []Order
+	}
+	joined := "select u.id, u.name, a.city, o.id, o.amount from user u left join address a left join orders o"
+	aliased := "select u.id, u.name, a.city as `address.city`, o.id as `orders.id`, o.amount as `orders.amount` from user u left join address a left join orders o"
+	values := [][]driver.Value{
+		{int64(1), "Lilei", "Beijing", int64(10), 1.5},
+		{int64(2), "Hanmeimei", nil, nil, nil},
+		{int64(1), "Lilei", "Beijing", int64(11), 2.5},
+		{int64(1), "Lilei", "Beijing", int64(10), 1.5},
+	}
+	SetFakeRows(joined, []string{"id", "name", "addr_city", "order_id", "order_amount"}, nil, values...)
+	SetFakeRows(aliased, []string{"id", "name", "address.city", "orders.id", "orders.amount"}, nil, values...)
+	xml := `<?xml version="1.0" encoding="utf-8"?>
+<sqlmap>
+	<resultMap id="userMap" type="User">
+		<id column="id" property="Id"/>
+		<result column="name" property="Name"/>
+		<association property="Address" columnPrefix="addr_">
+			<result column="city" property="City"/>
+		</association>
+		<collection property="Orders" columnPrefix="order_">
+			<id column="id" property="Id"/>
+		</collection>
+	</resultMap>
+	<select id="selectJoined" resultMap="userMap">` + joined + `</select>
+	<select id="selectAliased">` + aliased + `</select>
+</sqlmap>`
+	mapper, err := NewGoMapper(GetFakeConnection(), []byte(xml))
+	if err != nil {
+		fmt.Println(err.Error())
+		t.Fatal()
+	}
+	defer mapper.Close()
+
+	check := func(users []User) {
+		fmt.Printf("Users: %v\n", users)
+		if len(users) != 2 || users[0].Id != 1 || users[0].Address == nil || users[0].Address.City != "Beijing" ||
+			len(users[0].Orders) != 2 || users[0].Orders[1].Id != 11 || users[0].Orders[1].Amount != 2.5 {
+			t.Fatal()
+		}
+		if users[1].Name != "Hanmeimei" || users[1].Address != nil || users[1].Orders != nil {
+			t.Fatal()
+		}
+	}
+	for _, id := range []string{"selectJoined", "selectAliased"} {
+		var users []User
+		if err = mapper.SelectList(id, &users); err != nil {
+			fmt.Println(err.Error())
+			t.Fatal()
+		}
+		check(users)
+
+		pointers, err := List[*User](mapper, id)
+		if err != nil || len(pointers) != 2 {
+			t.Fatal()
+		}
+		check([]User{*pointers[0], *pointers[1]})
+
+		// rows of the same parent are not adjacent
+		cnt := 0
+		for user, err := range Iter[User](mapper, id) {
+			if err != nil {
+				t.Fatal()
+			}
+			cnt++
+			if cnt == 1 && len(user.Orders) != 1 {
+				t.Fatal()
+			}
+		}
+		if cnt != 3 {
+			t.Fatal()
+		}
+
+		if _, err = One[User](mapper, id); err == nil {
+			t.Fatal()
+		}
+		fmt.Println("Expected failure! error msg:", err.Error())
+	}
+
+	SetFakeRows(joined, []string{"id", "name", "addr_city", "order_id", "order_amount"}, nil, values[0], values[2])
+	user, err := One[User](mapper, "selectJoined")
+	if err != nil || len(user.Orders) != 2 {
+		fmt.Printf("unexpected user: %v, error: %v\n", user, err)
+		t.Fatal()
+	}
+
+	// Row.Scan folds all rows of the first struct
+	for _, id := range []string{"selectJoined", "selectAliased"} {
+		var user User
+		if err = mapper.Get(id).Scan(&user); err != nil || user.Id != 1 || len(user.Orders) != 2 || user.Orders[1].Id != 11 {
+			fmt.Printf("unexpected user: %v, error: %v\n", user, err)
+			t.Fatal()
+		}
+	}
+
+	type Invalid struct {
+		Id      int64
+		Name    string
+		Address string
+	}
+	var invalid []Invalid
+	if err = mapper.SelectList("selectAliased", &invalid); err == nil {
+		t.Fatal()
+	}
+	fmt.Println("Expected failure! error msg:", err.Error())
+}
+
+func TestNullSafeScan(t *testing.T) {
+	fmt.Println("\n---------- TestNullSafeScan ----------")
+	SetFakeRows("select id, first_name, last_name, nick, age from nulls", []string{"id", "first_name", "last_name", "nick", "age"}, nil,
+		[]driver.Value{int64(1), nil, nil, nil, nil},
+		[]driver.Value{int64(2), "Lilei", "Li", "LL", int64(20)})
+	SetFakeRows("select p.id, c.id, c.first_name from parent p join nulls c", []string{"id", "children.id", "children.first_name"}, nil,
+		[]driver.Value{int64(1), int64(1), nil},
+		[]driver.Value{int64(1), int64(2), "Lilei"})
+	xml := `<?xml version="1.0" encoding="utf-8"?>
+<sqlmap>
+	<select id="selectNulls">select id, first_name, last_name, nick, age from nulls</select>
+	<select id="selectNestedNulls">select p.id, c.id, c.first_name from parent p join nulls c</select>
+</sqlmap>`
+	mapper, err := NewGoMapper(GetFakeConnection(), []byte(xml))
+	if err != nil {
+		fmt.Println(err.Error())
+		t.Fatal()
+	}
+	defer mapper.Close()
+
+	type Nullable struct {
+		Id        int64
+		FirstName string
+		LastName  *string
+		Nick      sql.NullString
+		Age       sql.Null[int64]
+	}
+
+	// NULL of plain field fails by default
+	var records []Nullable
+	if err = mapper.SelectList("selectNulls", &records); err == nil {
+		t.Fatal()
+	}
+	fmt.Println("Expected failure! error msg:", err.Error())
+
+	// the same for nested levels
+	type Parent struct {
+		Id       int64
+		Children []Nullable
+	}
+	var parents []Parent
+	if err = mapper.SelectList("selectNestedNulls", &parents); err == nil {
+		t.Fatal()
+	}
+	fmt.Println("Expected failure! error msg:", err.Error())
+
+	mapper.SetNullAsZero(true)
+	defer mapper.SetNullAsZero(false)
+	if err = mapper.SelectList("selectNestedNulls", &parents); err != nil || len(parents[0].Children) != 2 {
+		fmt.Printf("unexpected records: %v, error: %v\n", parents, err)
+		t.Fatal()
+	}
+	if err = mapper.SelectList("selectNulls", &records); err != nil {
+		fmt.Println(err.Error())
+		t.Fatal()
+	}
+	fmt.Printf("Records: %v\n", records)
+	if records[0].FirstName != "" || records[0].LastName != nil || records[0].Nick.Valid || records[0].Age.Valid {
+		t.Fatal()
+	}
+	if records[1].FirstName != "Lilei" || *records[1].LastName != "Li" || records[1].Nick.String != "LL" || records[1].Age.V != 20 {
+		t.Fatal()
+	}
+
+	var id, age int64
+	var first, last, nick string
+	if err = mapper.Get("selectNulls").Scan(&id, &first, &last, &nick, &age); err != nil || id != 1 || first != "" || age != 0 {
+		fmt.Printf("unexpected values: %v %v %v, error: %v\n", id, first, age, err)
+		t.Fatal()
+	}
+}
+
+type Money int64 // in cents
+
+type moneyHandler struct{}
+
+func (moneyHandler) ToDB(value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	m := value.(Money)
+	return fmt.Sprintf("%d.%02d", m/100, m%100), nil
+}
+
+func (moneyHandler) FromDB(src interface{}) (interface{}, error) {
+	if src == nil {
+		return nil, nil
+	}
+	var yuan, cents int64
+	if _, err := fmt.Sscanf(fmt.Sprintf("%s", src), "%d.%d", &yuan, &cents); err != nil {
+		return nil, err
+	}
+	return Money(yuan*100 + cents), nil
+}
+
+type upperHandler struct{}
+
+func (upperHandler) ToDB(value interface{}) (interface{}, error) {
+	return strings.ToUpper(value.(string)), nil
+}
+
+func (upperHandler) FromDB(src interface{}) (interface{}, error) {
+	return strings.ToLower(fmt.Sprintf("%s", src)), nil
+}
+
+func TestTypeHandler(t *testing.T) {
+	fmt.Println("\n---------- TestTypeHandler ----------")
+	SetFakeRows("select id, code, price, discount from goods", []string{"id", "code", "price", "discount"}, nil,
+		[]driver.Value{int64(1), []byte("ABC"), []byte("12.34"), nil})
+	xml := `<?xml version="1.0" encoding="utf-8"?>
+<sqlmap>
+	<resultMap id="goodsMap">
+		<result column="code" property="Code" handler="upper"/>
+	</resultMap>
+	<select id="selectGoods" resultMap="goodsMap">select id, code, price, discount from goods</select>
+	<select id="selectPrice">select price from goods</select>
+	<insert id="insertGoods">insert into goods(code, price, discount) values(#{Code,handler=upper}, #{Price}, #{Discount})</insert>
+	<update id="updatePrice">update goods set price=#{Price} <where><if test="Code != ''">code=#{Code, handler=upper}</if></where></update>
+</sqlmap>`
+	SetFakeRows("select price from goods", []string{"price"}, nil, []driver.Value{[]byte("0.05")})
+	mapper, err := NewGoMapper(GetFakeConnection(), []byte(xml))
+	if err != nil {
+		fmt.Println(err.Error())
+		t.Fatal()
+	}
+	defer mapper.Close()
+
+	type Goods struct {
+		Id       int64
+		Code     string
+		Price    Money
+		Discount *Money
+	}
+
+	// handler is not registered
+	var goods Goods
+	if err = mapper.Get("selectGoods").Scan(&goods); err == nil {
+		t.Fatal()
+	}
+	fmt.Println("Expected failure! error msg:", err.Error())
+
+	mapper.RegisterTypeHandler(Money(0), moneyHandler{})
+	mapper.RegisterNamedTypeHandler("upper", upperHandler{})
+
+	if err = mapper.Get("selectGoods").Scan(&goods); err != nil {
+		fmt.Println(err.Error())
+		t.Fatal()
+	}
+	fmt.Printf("Goods: %v\n", goods)
+	if goods.Id != 1 || goods.Code != "abc" || goods.Price != 1234 || goods.Discount != nil {
+		t.Fatal()
+	}
+	var price Money
+	if err = mapper.Get("selectPrice").Scan(&price); err != nil || price != 5 {
+		fmt.Printf("unexpected price: %v, error: %v\n", price, err)
+		t.Fatal()
+	}
+
+	discount := Money(50)
+	expected := map[string][]interface{}{
+		"insertGoods": {"XYZ", "10.05", "0.50"},
+		"updatePrice": {"10.05", "XYZ"},
+	}
+	for id, want := range expected {
+		element, _ := mapper.sqlMap.Get(id)
+		_, args, err := element.bind([]interface{}{Goods{Code: "xyz", Price: 1005, Discount: &discount}}, SnakeCaseNaming, mapper.handlers)
+		if err != nil {
+			fmt.Println(err.Error())
+			t.Fatal()
+		}
+		fmt.Printf("Args: %v\n", args)
+		if !reflect.DeepEqual(args, want) {
+			t.Fatal()
+		}
+	}
+	if _, err = mapper.Insert("insertGoods", Goods{Code: "xyz"}); err != nil {
+		fmt.Println(err.Error())
+		t.Fatal()
+	}
+
+	// options are not part of the names of variables
+	insert, _ := mapper.sqlMap.Get("insertGoods")
+	args, err := ParseQueryArgs(insert.Vars, Goods{Code: "xyz", Price: 1005})
+	if err != nil || !reflect.DeepEqual(insert.Vars, []string{"Code", "Price", "Discount"}) || len(args) != 3 {
+		fmt.Printf("unexpected vars: %v, error: %v\n", insert.Vars, err)
+		t.Fatal()
+	}
+
+	// named handler without registered handlers, pointer argument is dereferenced
+	type P struct {
+		Tags *[]string
+	}
+	element := &SqlElement{Id: "insertTags", Sql: "INSERT INTO t(tags) VALUES(?)", Vars: []string{"Tags"}, handlers: []string{"json"}}
+	for _, arg := range []P{{Tags: &[]string{"a"}}, {}} {
+		_, args, err := element.bind([]interface{}{arg}, SnakeCaseNaming, nil)
+		if err != nil {
+			fmt.Println(err.Error())
+			t.Fatal()
+		}
+		fmt.Printf("Args: %v\n", args)
+		if arg.Tags != nil && !reflect.DeepEqual(args, []interface{}{`["a"]`}) || arg.Tags == nil && args[0] != nil {
+			t.Fatal()
+		}
+	}
+}
+
+func TestJSONColumn(t *testing.T) {
+	fmt.Println("\n---------- TestJSONColumn ----------")
+	SetFakeRows("select id, tags, attrs, meta from profile", []string{"id", "tags", "attrs", "meta"}, nil,
+		[]driver.Value{int64(1), []byte(`["a","b"]`), []byte(`{"k":"v"}`), []byte(`{"Level":3}`)},
+		[]driver.Value{int64(2), nil, nil, nil})
+	SetFakeRows("select id, labels from profile", []string{"id", "labels"}, nil,
+		[]driver.Value{int64(1), []byte(`["x"]`)})
+	xml := `<?xml version="1.0" encoding="utf-8"?>
+<sqlmap>
+	<resultMap id="labelMap">
+		<result column="labels" property="Labels" handler="json"/>
+	</resultMap>
+	<select id="selectProfiles">select id, tags, attrs, meta from profile</select>
+	<select id="selectLabels" resultMap="labelMap">select id, labels from profile</select>
+	<select id="selectInvalid">select id, tags from profile</select>
+	<insert id="insertProfile">insert into profile(tags, attrs, meta, labels) values(#{Tags}, #{Attrs}, #{Meta}, #{Labels,handler=json})</insert>
+	<update id="updateProfile">update profile <set><if test="Tags != nil">tags=#{Tags},</if></set> where id=#{Id}</update>
+</sqlmap>`
+	mapper, err := NewGoMapper(GetFakeConnection(), []byte(xml))
+	if err != nil {
+		fmt.Println(err.Error())
+		t.Fatal()
+	}
+	defer mapper.Close()
+
+	type Meta struct {
+		Level int
+	}
+	type Profile struct {
+		Id     int64
+		Tags   []string          `db:",json"`
+		Attrs  map[string]string `db:",json"`
+		Meta   *Meta             `db:",json"`
+		Labels []string
+	}
+
+	var profiles []Profile
+	if err = mapper.SelectList("selectProfiles", &profiles); err != nil {
+		fmt.Println(err.Error())
+		t.Fatal()
+	}
+	fmt.Printf("Profiles: %+v\n", profiles)
+	if len(profiles) != 2 || !reflect.DeepEqual(profiles[0].Tags, []string{"a", "b"}) || profiles[0].Attrs["k"] != "v" ||
+		profiles[0].Meta == nil || profiles[0].Meta.Level != 3 {
+		t.Fatal()
+	}
+	if profiles[1].Tags != nil || profiles[1].Attrs != nil || profiles[1].Meta != nil {
+		t.Fatal()
+	}
+
+	var labeled Profile
+	if err = mapper.SelectOne("selectLabels", &labeled); err != nil || !reflect.DeepEqual(labeled.Labels, []string{"x"}) {
+		fmt.Printf("unexpected labels: %v, error: %v\n", labeled.Labels, err)
+		t.Fatal()
+	}
+
+	// invalid JSON document
+	SetFakeRows("select id, tags from profile", []string{"id", "tags"}, nil, []driver.Value{int64(1), []byte(`{`)})
+	if err = mapper.SelectOne("selectInvalid", &labeled); err == nil {
+		t.Fatal()
+	}
+	fmt.Println("Expected failure! error msg:", err.Error())
+
+	expected := map[string][]interface{}{
+		"insertProfile": {`["a"]`, nil, `{"Level":1}`, `["y"]`},
+		"updateProfile": {`["a"]`, int64(5)},
+	}
+	for id, want := range expected {
+		element, _ := mapper.sqlMap.Get(id)
+		profile := Profile{Id: 5, Tags: []string{"a"}, Meta: &Meta{Level: 1}, Labels: []string{"y"}}
+		_, args, err := element.bind([]interface{}{profile}, SnakeCaseNaming, mapper.handlers)
+		if err != nil {
+			fmt.Println(err.Error())
+			t.Fatal()
+		}
+		fmt.Printf("Args: %v\n", args)
+		if !reflect.DeepEqual(args, want) {
+			t.Fatal()
+		}
+	}
+}
+
+func TestNamespace(t *testing.T) {
+	fmt.Println("\n---------- TestNamespace ----------")
+	userXml := `<sqlmap namespace="user">
+	<sql id="columns">id, name</sql>
+	<resultMap id="userMap"><result column="name" property="Name"/></resultMap>
+	<select id="selectAll" resultMap="userMap">SELECT <include refid="columns"/> FROM user</select>
+</sqlmap>`
+	orderXml := `<sqlmap namespace="order">
+	<sql id="columns">id, user_id</sql>
+	<select id="selectAll">SELECT <include refid="columns"/> FROM orders</select>
+	<select id="selectUsers" resultMap="user.userMap">SELECT <include refid="user.columns"/> FROM user</select>
+</sqlmap>`
+
+	sqlMap, err := NewSqlMap([]byte(userXml))
+	if err == nil {
+		err = sqlMap.Load([]byte(orderXml))
+	}
+	if err != nil {
+		fmt.Println(err.Error())
+		t.Fatal()
+	}
+	expected := map[string]string{
+		"user.selectAll":    "SELECT id, name FROM user",
+		"order.selectAll":   "SELECT id, user_id FROM orders",
+		"order.selectUsers": "SELECT id, name FROM user",
+	}
+	for id, want := range expected {
+		element, err := sqlMap.Get(id)
+		if err != nil || element.Sql != want || element.Id != id {
+			fmt.Printf("unexpected sql of '%s': %v, error: %v\n", id, element, err)
+			t.Fatal()
+		}
+	}
+	if element, _ := sqlMap.Get("user.selectAll"); element.ResultMap == nil || element.ResultMap.Id != "user.userMap" {
+		t.Fatal()
+	}
+	if _, err = sqlMap.Get("selectAll"); err == nil {
+		t.Fatal()
+	}
+
+	// duplicate ids within a file and across files
+	for _, x := range []string{
+		`<sqlmap><select id="s">SELECT 1 FROM t</select><select id="s">SELECT 2 FROM t</select></sqlmap>`,
+		`<sqlmap><select id="s">SELECT 1 FROM t</select><delete id="s">DELETE FROM t</delete></sqlmap>`,
+		`<sqlmap namespace="user"><select id="selectAll">SELECT 1 FROM t</select></sqlmap>`,
+		`<sqlmap namespace="user"><sql id="columns">id</sql></sqlmap>`,
+	} {
+		sqlMap, err := NewSqlMap([]byte(userXml))
+		if err == nil {
+			if _, err = NewSqlMap([]byte(x)); err == nil {
+				err = sqlMap.Load([]byte(x))
+			}
+		}
+		if err == nil {
+			fmt.Printf("%s should fail\n", x)
+			t.Fatal()
+		}
+		fmt.Println("Expected failure! error msg:", err.Error())
+	}
+
+	dir := t.TempDir()
+	files := []string{filepath.Join(dir, "user.xml"), filepath.Join(dir, "order.xml")}
+	for i, x := range []string{userXml, orderXml} {
+		if err = os.WriteFile(files[i], []byte(x), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mapper, err := NewGoMapperByFiles(GetFakeConnection(), files...)
+	if err != nil {
+		fmt.Println(err.Error())
+		t.Fatal()
+	}
+	defer mapper.Close()
+
+	SetFakeRows("SELECT id, name FROM user", []string{"id", "name"}, nil, []driver.Value{int64(1), []byte("Tom")})
+	var user struct {
+		Id   int64
+		Name string
+	}
+	if err = mapper.Get("user.selectAll").Scan(&user); err != nil || user.Name != "Tom" {
+		fmt.Printf("unexpected user: %v, error: %v\n", user, err)
+		t.Fatal()
+	}
+
+	// order.xml refers to fragment and resultMap of user.xml, which is loaded later
+	sqlMap, err = NewSqlMapByFiles(files[1], files[0])
+	if err != nil {
+		fmt.Println(err.Error())
+		t.Fatal()
+	}
+	if element, err := sqlMap.Get("order.selectUsers"); err != nil || element.Sql != expected["order.selectUsers"] ||
+		element.ResultMap == nil || element.ResultMap.Id != "user.userMap" {
+		fmt.Printf("unexpected sql of 'order.selectUsers': %v, error: %v\n", element, err)
+		t.Fatal()
+	}
+
+	// file name is reported
+	if _, err = NewSqlMapByFiles(files[0], files[0]); err == nil || !strings.Contains(err.Error(), "user.xml") {
+		t.Fatal()
+	}
+	fmt.Println("Expected failure! error msg:", err.Error())
+}
+
+func TestLoadFS(t *testing.T) {
+	fmt.Println("\n---------- TestLoadFS ----------")
+	file := func(ns, sql string) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte(fmt.Sprintf(`<sqlmap namespace="%s"><select id="selectAll">%s</select></sqlmap>`, ns, sql))}
+	}
+	fsys := fstest.MapFS{
+		"sql/user.xml":             file("user", "SELECT id, name FROM user"),
+		"sql/order/order.xml":      file("order", "SELECT id, user_id FROM orders"),
+		"sql/order/item/item.xml":  file("item", "SELECT id, order_id FROM items"),
+		"sql/order/readme.txt":     &fstest.MapFile{Data: []byte("not sqlmap")},
+		"other/user.xml":           file("user", "SELECT * FROM user"),
+		"bad/invalid.xml":          file("bad", "DELETE FROM user"),
+		"bad/duplicate/user.xml":   file("user", "SELECT * FROM user"),
+		"bad/duplicate/user2.xml":  file("user", "SELECT * FROM user"),
+		"bad/duplicate/zother.xml": file("other", "SELECT * FROM other"),
+	}
+
+	patterns := [][]string{
+		{"sql/**/*.xml"},
+		{"sql"},
+		{"sql/*.xml", "sql/order/**", "sql/**/*.xml"},
+	}
+	for _, p := range patterns {
+		sqlMap, err := NewSqlMapFS(fsys, p...)
+		if err != nil {
+			fmt.Println(err.Error())
+			t.Fatal()
+		}
+		for _, id := range []string{"user.selectAll", "order.selectAll", "item.selectAll"} {
+			if _, err = sqlMap.Get(id); err != nil {
+				fmt.Printf("%s is not loaded by %v\n", id, p)
+				t.Fatal()
+			}
+		}
+		if len(sqlMap.Sqls) != 3 {
+			t.Fatal()
+		}
+	}
+
+	// alpha.xml refers to resultMap and fragment of common.xml, which is loaded later
+	refs := fstest.MapFS{
+		"sql/alpha.xml": &fstest.MapFile{Data: []byte(`<sqlmap namespace="alpha">
+	<select id="selectAll" resultMap="common.m">SELECT <include refid="common.cols"/> FROM alpha</select>
+</sqlmap>`)},
+		"sql/common.xml": &fstest.MapFile{Data: []byte(`<sqlmap namespace="common">
+	<sql id="cols">id, name</sql>
+	<resultMap id="m"><result column="name" property="Name"/></resultMap>
+</sqlmap>`)},
+	}
+	sqlMap, err := NewSqlMapFS(refs, "sql/*.xml")
+	if err != nil {
+		fmt.Println(err.Error())
+		t.Fatal()
+	}
+	if element, err := sqlMap.Get("alpha.selectAll"); err != nil || element.Sql != "SELECT id, name FROM alpha" ||
+		element.ResultMap == nil || element.ResultMap.Id != "common.m" {
+		fmt.Printf("unexpected sql of 'alpha.selectAll': %v, error: %v\n", element, err)
+		t.Fatal()
+	}
+
+	// errors of all files are reported
+	_, err = NewSqlMapFS(fsys, "bad/**/*.xml")
+	if err == nil || !strings.Contains(err.Error(), "bad/invalid.xml") || !strings.Contains(err.Error(), "bad/duplicate/user2.xml") ||
+		strings.Contains(err.Error(), "zother.xml") {
+		t.Fatal()
+	}
+	fmt.Println("Expected failure! error msg:", err.Error())
+
+	for _, p := range []string{"sql/*.json", "nothing/**", "sql/[.xml"} {
+		if _, err = NewSqlMapFS(fsys, p); err == nil {
+			fmt.Printf("%s should fail\n", p)
+			t.Fatal()
+		}
+		fmt.Println("Expected failure! error msg:", err.Error())
+	}
+
+	mapper, err := NewGoMapperFS(GetFakeConnection(), fsys, "sql/**/*.xml")
+	if err != nil {
+		fmt.Println(err.Error())
+		t.Fatal()
+	}
+	defer mapper.Close()
+	SetFakeRows("SELECT id, name FROM user", []string{"id", "name"}, nil, []driver.Value{int64(1), []byte("Tom")})
+	var name string
+	var id int64
+	if err = mapper.Get("user.selectAll").Scan(&id, &name); err != nil || name != "Tom" {
+		fmt.Printf("unexpected name: %s, error: %v\n", name, err)
+		t.Fatal()
+	}
+}
+
+func TestWatchFiles(t *testing.T) {
+	fmt.Println("\n---------- TestWatchFiles ----------")
+	dir := t.TempDir()
+	file := filepath.Join(dir, "user.xml")
+	modified := time.Now()
+	write := func(xml string) {
+		if err := os.WriteFile(file, []byte(xml), 0644); err != nil {
+			t.Fatal(err)
+		}
+		// modification time may not be changed in a short time
+		modified = modified.Add(time.Second)
+		if err := os.Chtimes(file, modified, modified); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sqlOf := func(mapper *GoMapper, id string) string {
+		element, err := mapper.sqlMap.Get(id)
+		if err != nil {
+			return err.Error()
+		}
+		return element.Sql
+	}
+	waitFor := func(cond func() bool) {
+		for i := 0; i < 200 && !cond(); i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if !cond() {
+			t.Fatal()
+		}
+	}
+
+	write(`<sqlmap namespace="user"><select id="selectAll">SELECT id FROM user</select></sqlmap>`)
+	mapper, err := NewGoMapperByFiles(GetFakeConnection(), file)
+	if err != nil {
+		fmt.Println(err.Error())
+		t.Fatal()
+	}
+	defer mapper.Close()
+
+	logs := make(chan string, 10)
+	mapper.SetLogger(func(format string, args ...interface{}) {
+		logs <- fmt.Sprintf(format, args...)
+	})
+	watcher, err := mapper.WatchFiles(10*time.Millisecond, file)
+	if err != nil {
+		fmt.Println(err.Error())
+		t.Fatal()
+	}
+	defer watcher.Stop()
+	tx, err := mapper.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	write(`<sqlmap namespace="user"><select id="selectAll">SELECT id, name FROM user</select></sqlmap>`)
+	waitFor(func() bool { return sqlOf(mapper, "user.selectAll") == "SELECT id, name FROM user" })
+	// partially written file may be reported before reloaded
+	for msg := <-logs; !strings.Contains(msg, "reloaded"); msg = <-logs {
+	}
+	if sqlOf(&GoMapper{tx.Mapper}, "user.selectAll") != "SELECT id, name FROM user" {
+		t.Fatal()
+	}
+
+	// invalid file is reported, statements in use are kept
+	write(`<sqlmap namespace="user"><select id="selectAll">DELETE FROM user</select></sqlmap>`)
+	msg := <-logs
+	fmt.Print(msg)
+	if !strings.Contains(msg, "failed") || sqlOf(mapper, "user.selectAll") != "SELECT id, name FROM user" {
+		t.Fatal()
+	}
+
+	write(`<sqlmap namespace="user"><select id="selectAll">SELECT name FROM user</select></sqlmap>`)
+	waitFor(func() bool { return sqlOf(mapper, "user.selectAll") == "SELECT name FROM user" })
+	watcher.Stop()
+
+	// files added later are found by patterns of WatchFS
+	fsWatcher, err := mapper.WatchFS(time.Hour, os.DirFS(dir), "*.xml")
+	if err != nil {
+		fmt.Println(err.Error())
+		t.Fatal()
+	}
+	defer fsWatcher.Stop()
+	if err = os.WriteFile(filepath.Join(dir, "order.xml"), []byte(`<sqlmap namespace="order"><select id="selectAll">SELECT id FROM orders</select></sqlmap>`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = fsWatcher.Reload(); err != nil {
+		fmt.Println(err.Error())
+		t.Fatal()
+	}
+	if sqlOf(mapper, "order.selectAll") != "SELECT id FROM orders" || sqlOf(mapper, "user.selectAll") != "SELECT name FROM user" {
+		t.Fatal()
+	}
+
+	// cached statement of removed file is closed after reloaded
+	if err = mapper.SetStmtCache(true); err != nil {
+		t.Fatal(err)
+	}
+	query := "SELECT id FROM orders"
+	SetFakeRows(query, []string{"id"}, nil, []driver.Value{int64(1)})
+	prepared, closed := GetFakeStmtStats(query)
+	var id int64
+	if err = mapper.Get("order.selectAll").Scan(&id); err != nil || id != 1 {
+		fmt.Printf("unexpected id: %d, error: %v\n", id, err)
+		t.Fatal()
+	}
+	if p, c := GetFakeStmtStats(query); p != prepared+1 || c != closed {
+		fmt.Printf("statement should be cached, prepared: %d, closed: %d\n", p-prepared, c-closed)
+		t.Fatal()
+	}
+	if err = os.Remove(filepath.Join(dir, "order.xml")); err != nil {
+		t.Fatal(err)
+	}
+	if err = fsWatcher.Reload(); err != nil {
+		fmt.Println(err.Error())
+		t.Fatal()
+	}
+	if p, c := GetFakeStmtStats(query); p != prepared+1 || c != closed+1 {
+		fmt.Printf("statement of removed id should be closed, prepared: %d, closed: %d\n", p-prepared, c-closed)
+		t.Fatal()
+	}
+}
+
+func TestRegisterSql(t *testing.T) {
+	fmt.Println("\n---------- TestRegisterSql ----------")
+	mapper, err := NewGoMapper(GetFakeConnection(), []byte(`<sqlmap>
+	<sql id="columns">id, name</sql>
+	<select id="selectAll">SELECT id FROM user</select>
+</sqlmap>`))
+	if err != nil {
+		fmt.Println(err.Error())
+		t.Fatal()
+	}
+	defer mapper.Close()
+	if err = mapper.SetStmtCache(true); err != nil {
+		t.Fatal(err)
+	}
+
+	// queries run concurrently with changes
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					if _, err := mapper.sqlMap.Get("selectAll"); err != nil {
+						panic(err)
+					}
+					mapper.sqlMap.Get("report.daily")
+				}
+			}
+		}()
+	}
+
+	if err = mapper.RegisterXmlSql(SQL_SELECT, "report.daily", "SELECT <include refid=\"columns\"/> FROM report WHERE day=#{Day}"); err != nil {
+		fmt.Println(err.Error())
+		t.Fatal()
+	}
+	snapshot := mapper.Statements()
+	for _, f := range []func() error{
+		func() error { return mapper.RegisterSql(SQL_SELECT, "selectAll", "SELECT * FROM user") },
+		func() error { return mapper.RegisterSql(SQL_SELECT, "selectBad", "DELETE FROM user") },
+		func() error { return mapper.ReplaceSql(SQL_SELECT, "selectAll", "UPDATE user SET name=''") },
+		func() error { return mapper.RemoveSql("nothing") },
+		func() error {
+			return mapper.RegisterXmlSql(SQL_SELECT, "selectXml", "SELECT * FROM user WHERE age < #{Age}")
+		},
+	} {
+		if err = f(); err == nil {
+			t.Fatal()
+		}
+		fmt.Println("Expected failure! error msg:", err.Error())
+	}
+	element, err := mapper.sqlMap.Get("report.daily")
+	if err != nil || element.Sql != "SELECT id, name FROM report WHERE day=?" || !reflect.DeepEqual(element.Vars, []string{"Day"}) {
+		fmt.Printf("unexpected element: %v, error: %v\n", element, err)
+		t.Fatal()
+	}
+	if _, err = mapper.sqlMap.Get("selectBad"); err == nil {
+		t.Fatal()
+	}
+
+	SetFakeRows("SELECT id, name FROM report_v2", []string{"id", "name"}, nil, []driver.Value{int64(1), []byte("daily")})
+	if err = mapper.ReplaceSql(SQL_SELECT, "report.daily", "SELECT id, name FROM report_v2"); err != nil {
+		fmt.Println(err.Error())
+		t.Fatal()
+	}
+	var id int64
+	var name string
+	if err = mapper.Get("report.daily").Scan(&id, &name); err != nil || name != "daily" {
+		fmt.Printf("unexpected name: %s, error: %v\n", name, err)
+		t.Fatal()
+	}
+	if err = mapper.RemoveSql("report.daily"); err != nil {
+		t.Fatal(err)
+	}
+	close(stop)
+	wg.Wait()
+
+	// plain SQL is not parsed as xml, xml contents can have dynamic elements
+	if err = mapper.RegisterSql(SQL_SELECT, "selectYoung", "SELECT id FROM user WHERE age < #{Age} AND name <> '&'"); err != nil {
+		fmt.Println(err.Error())
+		t.Fatal()
+	}
+	if err = mapper.ReplaceXmlSql(SQL_SELECT, "selectYoung", `SELECT id FROM user <where><if test="Age != nil">age &lt; #{Age}</if></where>`); err != nil {
+		fmt.Println(err.Error())
+		t.Fatal()
+	}
+	element, _ = mapper.sqlMap.Get("selectYoung")
+	query, args, err := element.bind([]interface{}{map[string]interface{}{"Age": 18}}, SnakeCaseNaming, nil)
+	if err != nil || strings.Join(strings.Fields(query), " ") != "SELECT id FROM user WHERE age < ?" || !reflect.DeepEqual(args, []interface{}{18}) {
+		fmt.Printf("unexpected query: %s, args: %v, error: %v\n", query, args, err)
+		t.Fatal()
+	}
+	if err = mapper.ReplaceSql(SQL_SELECT, "selectYoung", "SELECT id FROM user WHERE age < #{Age}"); err != nil {
+		t.Fatal(err)
+	}
+	if element, _ = mapper.sqlMap.Get("selectYoung"); element.Sql != "SELECT id FROM user WHERE age < ?" || element.IsDynamic() {
+		t.Fatal()
+	}
+	if err = mapper.RemoveSql("selectYoung"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = mapper.sqlMap.Get("report.daily"); err == nil {
+		t.Fatal()
+	}
+	if len(snapshot) != 2 || snapshot[0].Id != "report.daily" || snapshot[1].Id != "selectAll" || len(mapper.Statements()) != 1 {
+		fmt.Printf("unexpected snapshot: %v\n", snapshot)
+		t.Fatal()
+	}
+
+	// changes are applied again when files are reloaded
+	dir := t.TempDir()
+	write := func(xml string) {
+		if err := os.WriteFile(filepath.Join(dir, "user.xml"), []byte(xml), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`<sqlmap>
+	<sql id="columns">id, name</sql>
+	<select id="selectAll">SELECT id FROM user</select>
+	<select id="selectOld">SELECT id FROM user_old</select>
+</sqlmap>`)
+	fsMapper, err := NewGoMapperFS(GetFakeConnection(), os.DirFS(dir), "*.xml")
+	if err != nil {
+		fmt.Println(err.Error())
+		t.Fatal()
+	}
+	defer fsMapper.Close()
+	watcher, err := fsMapper.WatchFS(time.Hour, os.DirFS(dir), "*.xml")
+	if err != nil {
+		fmt.Println(err.Error())
+		t.Fatal()
+	}
+	defer watcher.Stop()
+	for _, f := range []func() error{
+		func() error { return fsMapper.RegisterSql(SQL_SELECT, "report.daily", "SELECT * FROM report") },
+		func() error {
+			return fsMapper.RegisterXmlSql(SQL_SELECT, "report.find", `SELECT <include refid="columns"/> FROM report`)
+		},
+		func() error { return fsMapper.ReplaceSql(SQL_SELECT, "selectAll", "SELECT * FROM user") },
+		func() error { return fsMapper.RemoveSql("selectOld") },
+	} {
+		if err = f(); err != nil {
+			fmt.Println(err.Error())
+			t.Fatal()
+		}
+	}
+
+	write(`<sqlmap>
+	<sql id="columns">id, age</sql>
+	<select id="selectAll">SELECT id, age FROM user</select>
+	<select id="selectOld">SELECT id, age FROM user_old</select>
+	<select id="selectNew">SELECT id FROM user_new</select>
+</sqlmap>`)
+	if err = watcher.Reload(); err != nil {
+		fmt.Println(err.Error())
+		t.Fatal()
+	}
+	expected := map[string]string{
+		"report.daily": "SELECT * FROM report",
+		"report.find":  "SELECT id, age FROM report",
+		"selectAll":    "SELECT * FROM user",
+		"selectNew":    "SELECT id FROM user_new",
+	}
+	statements := fsMapper.Statements()
+	if len(statements) != len(expected) {
+		fmt.Printf("unexpected statements: %v\n", statements)
+		t.Fatal()
+	}
+	for _, element := range statements {
+		if element.Sql != expected[element.Id] {
+			fmt.Printf("unexpected sql of '%s': %s\n", element.Id, element.Sql)
+			t.Fatal()
+		}
+	}
+
+	// reload fails if a change can not be applied, statements in use are kept
+	write(`<sqlmap><select id="selectAll">SELECT id FROM user</select></sqlmap>`)
+	if err = watcher.Reload(); err == nil || !strings.Contains(err.Error(), "report.find") {
+		t.Fatal()
+	}
+	fmt.Println("Expected failure! error msg:", err.Error())
+	if !reflect.DeepEqual(fsMapper.Statements(), statements) {
+		t.Fatal()
+	}
+}
+
+func TestSqlMapError(t *testing.T) {
+	fmt.Println("\n---------- TestSqlMapError ----------")
+	xml := `<sqlmap namespace="user">
+	<select id="selectAll">SELECT id FROM user</select>
+	<select id="selectAll">SELECT name FROM user</select>
+	<insert id="insertUser">SELECT id FROM user</insert>
+	<select id="selectByName">SELECT id FROM user
+		WHERE name=#{Name</select>
+	<select id="selectMap" resultMap="nothing">SELECT id FROM user</select>
+</sqlmap>`
+	fsys := fstest.MapFS{"sql/user.xml": &fstest.MapFile{Data: []byte(xml)}}
+	_, err := NewSqlMapFS(fsys, "sql/*.xml")
+	if err == nil {
+		t.Fatal()
+	}
+	fmt.Println("Expected failure! error msg:", err.Error())
+
+	var errs SqlMapErrors
+	if !errors.As(err, &errs) || len(errs) != 4 {
+		t.Fatal()
+	}
+	expected := []SqlMapError{
+		{File: "sql/user.xml", Line: 3, Column: 2, Id: "user.selectAll"},
+		{File: "sql/user.xml", Line: 6, Column: 14, Id: "user.selectByName"},
+		{File: "sql/user.xml", Line: 7, Column: 2, Id: "user.selectMap"},
+		{File: "sql/user.xml", Line: 4, Column: 2, Id: "user.insertUser"},
+	}
+	for i, e := range errs {
+		want := expected[i]
+		want.Reason = e.Reason
+		if *e != want || e.Reason == "" {
+			fmt.Printf("unexpected error: %+v\n", *e)
+			t.Fatal()
+		}
+	}
+	var first *SqlMapError
+	if !errors.As(err, &first) || first != errs[0] {
+		t.Fatal()
+	}
+
+	// syntax error of xml
+	_, err = NewSqlMap([]byte("<sqlmap>\n<select id=\"s\">SELECT id FROM t</sqlmap>"))
+	if !errors.As(err, &first) || first.Line != 2 || first.File != "" {
+		t.Fatal()
+	}
+	fmt.Println("Expected failure! error msg:", err.Error())
+
+	// position of unmatched brace
+	_, _, err = FormatSqlAndVars("SELECT id FROM t WHERE a=#{A} AND b=#{B")
+	if err == nil || !strings.Contains(err.Error(), "offset 36") {
+		t.Fatal()
+	}
+	fmt.Println("Expected failure! error msg:", err.Error())
+}
+
+func TestCheckSqlType(t *testing.T) {
+	fmt.Println("\n---------- TestCheckSqlType ----------")
+	cases := map[string]SqlType{
+		"SELECT 1":                                                    SQL_SELECT,
+		"\t select * from t":                                          SQL_SELECT,
+		"-- comment\nSELECT id FROM t":                                SQL_SELECT,
+		"# comment\n/* multi\nline */ SELECT":                         SQL_SELECT,
+		"(SELECT id FROM a) UNION (SELECT id FROM b)":                 SQL_SELECT,
+		"WITH t AS (SELECT id FROM x WHERE id=#{Id}) SELECT * FROM t": SQL_SELECT,
+		"INSERT INTO t(a) VALUES(#{A}) # comment":                     SQL_INSERT,
+		"WITH t AS (SELECT id FROM a) SELECT * FROM t":                SQL_SELECT,
+		"WITH RECURSIVE t(n) AS (SELECT 1 UNION ALL SELECT n+1 FROM t) SELECT n FROM t":     SQL_SELECT,
+		"WITH a AS (SELECT 1), b AS (SELECT 2) DELETE FROM t WHERE id IN (SELECT * FROM a)": SQL_DELETE,
+		"with t as (select id from a) update x join t using(id) set y=1":                    SQL_UPDATE,
+		"REPLACE INTO t(id) VALUES(?)":       SQL_INSERT,
+		"INSERT IGNORE INTO t(id) VALUES(?)": SQL_INSERT,
+		"INSERT INTO t(id) SELECT id FROM a": SQL_INSERT,
+		"/* SELECT */ DELETE FROM t":         SQL_DELETE,
+		"UPDATE t SET name='--' WHERE id=?":  SQL_UPDATE,
+		"":                                   SQL_TYPE_BEGIN,
+		"(":                                  SQL_TYPE_BEGIN,
+		"/* unterminated":                    SQL_TYPE_BEGIN,
+		"'unterminated":                      SQL_TYPE_BEGIN,
+		"--":                                 SQL_TYPE_BEGIN,
+		"SELECTS":                            SQL_TYPE_BEGIN,
+		"WITH t AS (SELECT 1)":               SQL_TYPE_BEGIN,
+		"WITH `select` AS (SELECT 1) DELETE FROM t": SQL_DELETE,
+		"SHOW TABLES": SQL_TYPE_BEGIN,
+	}
+	for sql, want := range cases {
+		if got := SqlTypeOf(sql); got != want {
+			fmt.Printf("type of [%s] is %s, expected %s\n", sql, got, want)
+			t.Fatal()
+		}
+	}
+
+	if err := CheckSqlType("SELECT 1", SQL_SELECT); err != nil {
+		t.Fatal(err)
+	}
+	err := CheckSqlType("INSERT INTO t SELECT 1", SQL_SELECT)
+	if err == nil {
+		t.Fatal()
+	}
+	fmt.Println("Expected failure! error msg:", err.Error())
+
+	// short statements and variables in common table expressions are parsed
+	if _, err = NewSqlMap([]byte(`<sqlmap><select id="s">SELECT 1</select><delete id="d">DELETE</delete>
+	<select id="cte">WITH t AS (SELECT id FROM x WHERE id=#{Id})
+		SELECT * FROM t</select></sqlmap>`)); err != nil {
+		fmt.Println(err.Error())
+		t.Fatal()
+	}
+}
+
+func benchmarkScan(b *testing.B, scan func(rows *Rows) error) {
+	setFakeRecords(100)
+	mapper, err := NewGoMapper(GetFakeConnection(), []byte(xmlsqls))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer mapper.Close()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rows, err := mapper.Select("selectAll")
+		if err != nil {
+			b.Fatal(err)
+		}
+		for rows.Next() {
+			if err = scan(rows); err != nil {
+				b.Fatal(err)
+			}
+		}
+		rows.Close()
+	}
+}
+
+// scan into fields one by one
+func BenchmarkScanFields(b *testing.B) {
+	benchmarkScan(b, func(rows *Rows) error {
+		var rec Record
+		return rows.Scan(&rec.Id, &rec.FirstName, &rec.LastName, &rec.EmailVerified, &rec.CreatedAt)
+	})
+}
+
+// scan into struct, columns are resolved for every row as ScanToStruct did before plans are cached
+func BenchmarkScanStructNoCache(b *testing.B) {
+	benchmarkScan(b, func(rows *Rows) error {
+		var rec Record
+		columns, err := rows.Columns()
+		if err != nil {
+			return err
+		}
+		plan, err := newScanPlan(reflect.TypeOf(rec), columns, SnakeCaseNaming, scanOptions{policy: COLUMN_STRICT})
+		if err != nil {
+			return err
+		}
+		return plan.scan(rows.rows, reflect.ValueOf(&rec).Elem(), columns)
+	})
+}
+
+// scan into struct with cached plan
+func BenchmarkScanStruct(b *testing.B) {
+	benchmarkScan(b, func(rows *Rows) error {
+		var rec Record
+		return rows.Scan(&rec)
+	})
+}
@@ -0,0 +1,171 @@
+package gomapper
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Watcher reloads sqlmap files of a mapper when they are changed, files are checked by polling
+// size and modification time, such as:
+//
+//	mapper, err := NewGoMapperByFiles(db, "user.xml", "order.xml")
+//	watcher, err := mapper.WatchFiles(5*time.Second, "user.xml", "order.xml")
+//	defer watcher.Stop()
+//
+// Changed files are parsed into a new SqlMap, which replaces the SqlMap of the mapper atomically
+// only if all files are loaded without error, otherwise statements in use are kept.
+// Statements changed by RegisterSql etc. are applied again to the reloaded SqlMap, see registry.go.
+// Reloads and errors are reported by the logger of mapper, set the logger before watching.
+// Transactions begun from the mapper use the reloaded statements as well, cached prepared statements
+// of removed or changed ids are closed.
+type Watcher struct {
+	gm       *GoMapper
+	load     func() (*SqlMap, error)
+	version  func() (string, error) // changed if any file is changed, added or removed
+	interval time.Duration
+
+	mu   sync.Mutex // serializes reloads
+	last string     // version of files when loaded last time
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// watch files loaded by NewGoMapperByFiles, interval <= 0 means 1 second
+func (gm *GoMapper) WatchFiles(interval time.Duration, xmlFilePaths ...string) (*Watcher, error) {
+	version := func() (string, error) {
+		return filesVersion(xmlFilePaths, os.Stat)
+	}
+	load := func() (*SqlMap, error) {
+		return NewSqlMapByFiles(xmlFilePaths...)
+	}
+	return gm.watch(interval, load, version)
+}
+
+// watch files loaded by NewGoMapperFS, files added or removed later are found by the patterns,
+// fsys must reflect changes of files, such as os.DirFS
+func (gm *GoMapper) WatchFS(interval time.Duration, fsys fs.FS, patterns ...string) (*Watcher, error) {
+	version := func() (string, error) {
+		files, err := globFS(fsys, patterns)
+		if err != nil {
+			return "", err
+		}
+		return filesVersion(files, func(name string) (fs.FileInfo, error) {
+			return fs.Stat(fsys, name)
+		})
+	}
+	load := func() (*SqlMap, error) {
+		return NewSqlMapFS(fsys, patterns...)
+	}
+	return gm.watch(interval, load, version)
+}
+
+func (gm *GoMapper) watch(interval time.Duration, load func() (*SqlMap, error), version func() (string, error)) (*Watcher, error) {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	last, err := version()
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Watcher{gm: gm, load: load, version: version, interval: interval, last: last,
+		stop: make(chan struct{}), done: make(chan struct{})}
+	go w.run()
+	return w, nil
+}
+
+// stop polling, the mapper keeps the statements loaded last time
+func (w *Watcher) Stop() {
+	w.once.Do(func() {
+		close(w.stop)
+	})
+	<-w.done
+}
+
+// reload files immediately, the SqlMap of mapper is not changed if error is returned
+func (w *Watcher) Reload() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// changes after the version are loaded again in next check
+	version, err := w.version()
+	if err != nil {
+		version = err.Error()
+	}
+	w.last = version
+
+	var sqlMap *SqlMap
+	if err == nil {
+		sqlMap, err = w.load()
+	}
+	if err == nil {
+		err = w.gm.sqlMap.reload(sqlMap)
+	}
+	if err != nil {
+		w.log("reload sqlmap failed, statements in use are kept: %s\n", err.Error())
+		return err
+	}
+
+	if w.gm.stmts != nil {
+		// statements of removed ids would never be used again
+		w.gm.stmts.sync(sqlMap)
+	}
+	w.log("sqlmap reloaded, %d statements\n", len(sqlMap.Sqls))
+	return nil
+}
+
+func (w *Watcher) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			w.check()
+		}
+	}
+}
+
+// reload if files are changed since last time
+func (w *Watcher) check() {
+	version, err := w.version()
+	if err != nil {
+		version = err.Error()
+	}
+	w.mu.Lock()
+	changed := version != w.last
+	w.mu.Unlock()
+
+	if changed {
+		w.Reload()
+	}
+}
+
+func (w *Watcher) log(format string, args ...interface{}) {
+	if w.gm.logFunc != nil {
+		w.gm.logFunc(context.Background(), format, args...)
+	}
+}
+
+// names, sizes and modification times of files
+func filesVersion(files []string, stat func(name string) (fs.FileInfo, error)) (string, error) {
+	var buf strings.Builder
+	for _, name := range files {
+		info, err := stat(name)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&buf, "%s:%d:%d;", name, info.Size(), info.ModTime().UnixNano())
+	}
+	return buf.String(), nil
+}